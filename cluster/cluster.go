@@ -0,0 +1,427 @@
+package cluster
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/jslyzt/einx/agent"
+	"github.com/jslyzt/einx/component"
+	"github.com/jslyzt/einx/context"
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/module"
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+type (
+	Agent         = agent.Agent
+	AgentID       = agent.AgentID
+	Module        = context.Module
+	Context       = context.Context
+	RpcCallback   = context.RpcCallback
+	ComponentID   = component.ComponentID
+	EventMsg      = event.EventMsg
+	EventType     = event.EventType
+	EventReceiver = event.EventReceiver
+	ProtoTypeID   = network.ProtoTypeID
+	NetLinker     = network.NetLinker
+)
+
+const (
+	CLUSTER_MSG_HELLO ProtoTypeID = iota + 1
+	CLUSTER_MSG_REQUEST
+	CLUSTER_MSG_REPLY
+	CLUSTER_MSG_ANNOUNCE
+)
+
+var (
+	CLUSTER_TICK_INTERVAL uint64 = 1000 //Millisecond
+)
+
+var (
+	ErrRpcPath        = errors.New("cluster rpc path error")
+	ErrNodeNotFound   = errors.New("cluster node not connected")
+	ErrModuleNotFound = errors.New("cluster module not found")
+	ErrLinkClosed     = errors.New("cluster link closed")
+)
+
+type pendingCall struct {
+	caller   Module
+	session  uint64
+	node     string
+	deadline int64
+}
+
+type ClusterMgr struct {
+	name       string
+	addr       string
+	seeds      []SeedProvider
+	client     network.ITcpClientMgr
+	lock       sync.RWMutex
+	peers      map[string]string
+	connecting map[string]bool
+	nodes      map[string]*RemoteNode
+	linkers    map[AgentID]*RemoteNode
+	services   map[string][]string
+	calls      map[uint64]*pendingCall
+	callSeq    uint64
+	ticking    bool
+}
+
+var defaultMgr *ClusterMgr
+
+func NewClusterMgr(name string) *ClusterMgr {
+	mgr := &ClusterMgr{
+		name:       name,
+		peers:      make(map[string]string),
+		connecting: make(map[string]bool),
+		nodes:      make(map[string]*RemoteNode),
+		linkers:    make(map[AgentID]*RemoteNode),
+		services:   make(map[string][]string),
+		calls:      make(map[uint64]*pendingCall),
+	}
+	defaultMgr = mgr
+	return mgr
+}
+
+func Default() *ClusterMgr {
+	return defaultMgr
+}
+
+// Call routes "node/module.rpcName" to the default cluster manager.
+func Call(caller Module, path string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	if defaultMgr == nil {
+		slog.LogError("cluster", "cluster not initialized, rpc [%v] dropped", path)
+		return
+	}
+	defaultMgr.Call(caller, path, timeout, cb, args...)
+}
+
+func (mgr *ClusterMgr) GetName() string {
+	return mgr.name
+}
+
+// SetAddr sets the listen address announced to the other nodes.
+func (mgr *ClusterMgr) SetAddr(addr string) {
+	mgr.addr = addr
+}
+
+func (mgr *ClusterMgr) AddPeer(node string, addr string) {
+	mgr.AddSeeds(StaticSeeds{node: addr})
+}
+
+func (mgr *ClusterMgr) AddSeeds(p SeedProvider) {
+	mgr.seeds = append(mgr.seeds, p)
+}
+
+func (mgr *ClusterMgr) GetNode(name string) *RemoteNode {
+	mgr.lock.RLock()
+	n := mgr.nodes[name]
+	mgr.lock.RUnlock()
+	return n
+}
+
+// Call accepts "node/module.rpcName", or "module.rpcName" resolved by the registry.
+func (mgr *ClusterMgr) Call(caller Module, path string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	node, name, rpc, ok := parseRpcPath(path)
+	if ok && node == "" {
+		node, ok = mgr.Resolve(name)
+		if !ok {
+			mgr.fail(caller, module.NewRpcSession(caller, cb, timeout), ErrModuleNotFound)
+			return
+		}
+	}
+	if !ok {
+		mgr.fail(caller, module.NewRpcSession(caller, cb, timeout), ErrRpcPath)
+		return
+	}
+
+	if node == mgr.name {
+		mgr.callLocal(caller, name, rpc, timeout, cb, args)
+		return
+	}
+
+	session := module.NewRpcSession(caller, cb, timeout)
+	if session == 0 {
+		return
+	}
+
+	n := mgr.GetNode(node)
+	if n == nil {
+		mgr.fail(caller, session, ErrNodeNotFound)
+		return
+	}
+
+	reqID := mgr.addPending(caller, session, node, timeout)
+	b, err := network.RpcEncode(make([]byte, 0, 128), []interface{}{reqID, name, rpc, args})
+	if err != nil {
+		if mgr.removePending(reqID) != nil {
+			mgr.fail(caller, session, err)
+		}
+		return
+	}
+	if !n.linker.RpcCall(CLUSTER_MSG_REQUEST, b) {
+		if mgr.removePending(reqID) != nil {
+			mgr.fail(caller, session, ErrLinkClosed)
+		}
+	}
+}
+
+func (mgr *ClusterMgr) callLocal(caller Module, name string, rpc string, timeout uint64, cb RpcCallback, args []interface{}) {
+	if target := module.FindModule(name); target != nil {
+		target.Call(caller, rpc, timeout, cb, args...)
+		return
+	}
+	if pool := module.FindWorkerPool(name); pool != nil {
+		pool.Call(caller, rpc, timeout, cb, args...)
+		return
+	}
+	mgr.fail(caller, module.NewRpcSession(caller, cb, timeout), ErrModuleNotFound)
+}
+
+func parseRpcPath(path string) (string, string, string, bool) {
+	node, rest := "", path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		if i == 0 {
+			return "", "", "", false
+		}
+		node, rest = path[:i], path[i+1:]
+	}
+	j := strings.IndexByte(rest, '.')
+	if j <= 0 || j == len(rest)-1 {
+		return "", "", "", false
+	}
+	return node, rest[:j], rest[j+1:], true
+}
+
+func (mgr *ClusterMgr) fail(caller Module, session uint64, err error) {
+	if session == 0 {
+		return
+	}
+	r, ok := caller.(EventReceiver)
+	if !ok {
+		return
+	}
+	e := &event.RpcReplyEventMsg{}
+	e.MsgType = event.EVENT_MODULE_RPC_REPLY
+	e.Session = session
+	e.Err = err
+	r.PushEventMsg(e)
+}
+
+func (mgr *ClusterMgr) addPending(caller Module, session uint64, node string, timeout uint64) uint64 {
+	call := &pendingCall{
+		caller:  caller,
+		session: session,
+		node:    node,
+	}
+	if timeout > 0 {
+		call.deadline = network.UnixTS() + int64(timeout)
+	}
+	mgr.lock.Lock()
+	mgr.callSeq++
+	reqID := mgr.callSeq
+	mgr.calls[reqID] = call
+	mgr.lock.Unlock()
+	return reqID
+}
+
+func (mgr *ClusterMgr) removePending(reqID uint64) *pendingCall {
+	mgr.lock.Lock()
+	call, ok := mgr.calls[reqID]
+	if ok {
+		delete(mgr.calls, reqID)
+	}
+	mgr.lock.Unlock()
+	return call
+}
+
+func (mgr *ClusterMgr) onTick(args []interface{}) {
+	m := args[0].(Module)
+	now := network.UnixTS()
+	mgr.lock.Lock()
+	for reqID, call := range mgr.calls {
+		if call.deadline > 0 && call.deadline < now {
+			delete(mgr.calls, reqID) // the caller has already timed out
+		}
+	}
+	mgr.lock.Unlock()
+	mgr.connectPeers()
+	m.AddTimer(CLUSTER_TICK_INTERVAL, mgr.onTick, m)
+}
+
+func (mgr *ClusterMgr) OnComponentCreate(ctx Context, id ComponentID) {
+	c := ctx.GetComponent()
+	if client, ok := c.(network.ITcpClientMgr); ok {
+		mgr.client = client
+		mgr.connectPeers()
+	}
+	if !mgr.ticking {
+		mgr.ticking = true
+		m := ctx.GetModule()
+		m.AddTimer(CLUSTER_TICK_INTERVAL, mgr.onTick, m)
+	}
+	c.Start()
+}
+
+func (mgr *ClusterMgr) OnComponentError(ctx Context, err error) {
+	if node, ok := ctx.GetAttach().(string); ok {
+		mgr.lock.Lock()
+		delete(mgr.connecting, node)
+		mgr.lock.Unlock()
+	}
+	slog.LogWarning("cluster", "cluster node [%v] component error: %v", ctx.GetAttach(), err)
+}
+
+func (mgr *ClusterMgr) OnLinkerConnected(id AgentID, a Agent) {
+	linker := a.(NetLinker)
+	if node, ok := linker.GetUserType().(string); ok {
+		mgr.lock.Lock()
+		delete(mgr.connecting, node)
+		mgr.lock.Unlock()
+	}
+	b, _ := network.RpcMarshal(nil, mgr.name) // a string always encodes
+	linker.RpcCall(CLUSTER_MSG_HELLO, b)
+	mgr.announce(linker)
+}
+
+func (mgr *ClusterMgr) OnLinkerClosed(id AgentID, a Agent, err error) {
+	var failed []*pendingCall
+	mgr.lock.Lock()
+	n, ok := mgr.linkers[id]
+	if ok {
+		delete(mgr.linkers, id)
+		if mgr.nodes[n.name] == n {
+			delete(mgr.nodes, n.name)
+			for _, other := range mgr.linkers {
+				if other.name == n.name {
+					mgr.nodes[n.name] = other // keep the node through its other link
+					break
+				}
+			}
+		}
+		if _, alive := mgr.nodes[n.name]; !alive {
+			for reqID, call := range mgr.calls {
+				if call.node == n.name {
+					delete(mgr.calls, reqID)
+					failed = append(failed, call)
+				}
+			}
+		}
+		mgr.rebuildServices()
+	}
+	mgr.lock.Unlock()
+
+	if !ok {
+		return
+	}
+	slog.LogWarning("cluster", "cluster node [%v] link closed: %v", n.name, err)
+	for _, call := range failed {
+		mgr.fail(call.caller, call.session, ErrLinkClosed)
+	}
+}
+
+func (mgr *ClusterMgr) ServeHandler(a Agent, msgID ProtoTypeID, b []byte) {
+	slog.LogWarning("cluster", "cluster link [%v] unknown msg [%v]", a.GetID(), msgID)
+}
+
+func (mgr *ClusterMgr) ServeRpc(a Agent, msgID ProtoTypeID, b []byte) {
+	switch msgID {
+	case CLUSTER_MSG_HELLO:
+		mgr.onHello(a.(NetLinker), b)
+	case CLUSTER_MSG_ANNOUNCE:
+		mgr.onAnnounce(a.(NetLinker), b)
+	case CLUSTER_MSG_REQUEST:
+		mgr.onRequest(a.(NetLinker), b)
+	case CLUSTER_MSG_REPLY:
+		mgr.onReply(b)
+	default:
+		slog.LogWarning("cluster", "cluster link [%v] unknown rpc [%v]", a.GetID(), msgID)
+	}
+}
+
+func (mgr *ClusterMgr) onHello(linker NetLinker, b []byte) {
+	v, _, err := network.RpcUnMarshal(b)
+	name, ok := v.(string)
+	if err != nil || !ok || name == "" || name == mgr.name {
+		slog.LogWarning("cluster", "cluster link [%v] hello error [%v] %v", linker.GetID(), v, err)
+		linker.Close()
+		return
+	}
+	n := &RemoteNode{
+		name:   name,
+		linker: linker,
+	}
+	mgr.lock.Lock()
+	if old, ok := mgr.nodes[name]; ok {
+		n.info = old.info
+	}
+	mgr.linkers[linker.GetID()] = n
+	mgr.nodes[name] = n
+	mgr.lock.Unlock()
+	slog.LogInfo("cluster", "cluster node [%v] connected %v", name, linker.RemoteAddr())
+}
+
+func (mgr *ClusterMgr) onRequest(linker NetLinker, b []byte) {
+	mgr.lock.RLock()
+	n := mgr.linkers[linker.GetID()]
+	mgr.lock.RUnlock()
+	if n == nil {
+		slog.LogWarning("cluster", "cluster link [%v] request before hello", linker.GetID())
+		return
+	}
+
+	v, _, err := network.RpcUnMarshal(b)
+	req, _ := v.([]interface{})
+	if err != nil || len(req) < 4 {
+		slog.LogWarning("cluster", "cluster node [%v] request error %v", n.name, err)
+		return
+	}
+	reqID, _ := req[0].(uint64)
+	name, _ := req[1].(string)
+	rpc, _ := req[2].(string)
+	args, _ := req[3].([]interface{})
+	if reqID == 0 {
+		slog.LogWarning("cluster", "cluster node [%v] request error", n.name)
+		return
+	}
+
+	var target Module = module.FindModule(name)
+	if target == nil {
+		if pool := module.FindWorkerPool(name); pool != nil {
+			target = pool.Const(rpc)
+		}
+	}
+	if target == nil {
+		n.reply(reqID, nil, ErrModuleNotFound)
+		return
+	}
+	target.(module.ModuleRouter).RouterCall(n, reqID, rpc, args)
+}
+
+func (mgr *ClusterMgr) onReply(b []byte) {
+	v, _, err := network.RpcUnMarshal(b)
+	rsp, _ := v.([]interface{})
+	if err != nil || len(rsp) < 3 {
+		slog.LogWarning("cluster", "cluster reply error %v", err)
+		return
+	}
+	reqID, _ := rsp[0].(uint64)
+	call := mgr.removePending(reqID)
+	if call == nil {
+		return
+	}
+	r, ok := call.caller.(EventReceiver)
+	if !ok {
+		return
+	}
+	e := &event.RpcReplyEventMsg{}
+	e.MsgType = event.EVENT_MODULE_RPC_REPLY
+	e.Session = call.session
+	e.Data, _ = rsp[2].([]interface{})
+	if s, ok := rsp[1].(string); ok {
+		e.Err = decodeError(s)
+	}
+	r.PushEventMsg(e)
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"errors"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/module"
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+// RemoteNode is the sender of rpc requests coming from another node,
+// replies pushed to it are sent back over the cluster link.
+type RemoteNode struct {
+	name   string
+	linker NetLinker
+	info   NodeInfo
+}
+
+func (n *RemoteNode) GetID() AgentID {
+	return n.linker.GetID()
+}
+
+func (n *RemoteNode) GetName() string {
+	return n.name
+}
+
+func (n *RemoteNode) GetLinker() NetLinker {
+	return n.linker
+}
+
+func (n *RemoteNode) Close() {
+	n.linker.Close()
+}
+
+func (n *RemoteNode) PostEvent(eventType EventType, agent Agent, cid ComponentID, args ...interface{}) {
+}
+
+func (n *RemoteNode) PostData(eventType EventType, typeID ProtoTypeID, agent Agent, data interface{}) {
+}
+
+func (n *RemoteNode) PushEventMsg(ev EventMsg) {
+	replyMsg, ok := ev.(*event.RpcReplyEventMsg)
+	if !ok {
+		slog.LogWarning("cluster", "cluster node [%v] unsupported event [%v]", n.name, ev.GetType())
+		return
+	}
+	n.reply(replyMsg.Session, replyMsg.Data, replyMsg.Err)
+}
+
+func (n *RemoteNode) reply(reqID uint64, data []interface{}, err error) {
+	var errString interface{} = nil
+	if err != nil {
+		errString = err.Error()
+	}
+	b, encodeErr := network.RpcEncode(make([]byte, 0, 64), []interface{}{reqID, errString, data})
+	if encodeErr != nil {
+		b, _ = network.RpcMarshal(make([]byte, 0, 64), []interface{}{reqID, encodeErr.Error(), nil})
+	}
+	n.linker.RpcCall(CLUSTER_MSG_REPLY, b)
+}
+
+var knownErrors = []error{
+	module.ErrRpcTimeout,
+	module.ErrRpcNoHandler,
+	ErrRpcPath,
+	ErrNodeNotFound,
+	ErrModuleNotFound,
+	ErrLinkClosed,
+	network.ErrRpcType,
+}
+
+func decodeError(s string) error {
+	for _, err := range knownErrors {
+		if err.Error() == s {
+			return err
+		}
+	}
+	return errors.New(s)
+}
@@ -0,0 +1,216 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/jslyzt/einx/module"
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+// SeedProvider supplies the addresses of the nodes to connect, keyed by node name.
+// It is polled on every cluster tick, so backends may change the result at runtime.
+type SeedProvider interface {
+	Seeds() (map[string]string, error)
+}
+
+type StaticSeeds map[string]string
+
+func (s StaticSeeds) Seeds() (map[string]string, error) {
+	return s, nil
+}
+
+// FileSeeds reads a json object of node name to address, e.g. {"login": "10.0.0.1:7001"}.
+type FileSeeds string
+
+func (f FileSeeds) Seeds() (map[string]string, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	seeds := make(map[string]string)
+	if err := json.Unmarshal(b, &seeds); err != nil {
+		return nil, err
+	}
+	return seeds, nil
+}
+
+type NodeInfo struct {
+	Name    string
+	Addr    string
+	Modules []string
+	Pools   []string
+}
+
+// Resolve returns the node serving the module or worker pool [name],
+// the local node is preferred. Nodes leave the registry when their link
+// is closed, which includes keep alive timeouts.
+func (mgr *ClusterMgr) Resolve(name string) (string, bool) {
+	if module.FindModule(name) != nil || module.FindWorkerPool(name) != nil {
+		return mgr.name, true
+	}
+	mgr.lock.RLock()
+	nodes := mgr.services[name]
+	mgr.lock.RUnlock()
+	if len(nodes) == 0 {
+		return "", false
+	}
+	return nodes[0], true
+}
+
+func (mgr *ClusterMgr) Nodes() []NodeInfo {
+	mgr.lock.RLock()
+	infos := make([]NodeInfo, 0, len(mgr.nodes))
+	for _, n := range mgr.nodes {
+		infos = append(infos, n.info)
+	}
+	mgr.lock.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Announce sends the local modules and worker pools to every connected node,
+// call it after modules are created at runtime.
+func (mgr *ClusterMgr) Announce() {
+	mgr.lock.RLock()
+	linkers := make([]NetLinker, 0, len(mgr.linkers))
+	for _, n := range mgr.linkers {
+		linkers = append(linkers, n.linker)
+	}
+	mgr.lock.RUnlock()
+	for _, linker := range linkers {
+		mgr.announce(linker)
+	}
+}
+
+func (mgr *ClusterMgr) announce(linker NetLinker) {
+	modules := make([]interface{}, 0, 8)
+	for _, name := range module.ModuleNames() {
+		modules = append(modules, name)
+	}
+	pools := make([]interface{}, 0, 4)
+	for _, name := range module.WorkerPoolNames() {
+		pools = append(pools, name)
+	}
+	peers := make(map[string]interface{})
+	mgr.lock.RLock()
+	for node, addr := range mgr.peers {
+		peers[node] = addr
+	}
+	mgr.lock.RUnlock()
+
+	b, err := network.RpcMarshal(make([]byte, 0, 256), []interface{}{mgr.addr, modules, pools, peers})
+	if err != nil {
+		slog.LogError("cluster", "cluster announce error %v", err)
+		return
+	}
+	linker.RpcCall(CLUSTER_MSG_ANNOUNCE, b)
+}
+
+func (mgr *ClusterMgr) onAnnounce(linker NetLinker, b []byte) {
+	v, _, err := network.RpcUnMarshal(b)
+	msg, _ := v.([]interface{})
+	if err != nil || len(msg) < 4 {
+		slog.LogWarning("cluster", "cluster link [%v] announce error %v", linker.GetID(), err)
+		return
+	}
+
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	n := mgr.linkers[linker.GetID()]
+	if n == nil {
+		slog.LogWarning("cluster", "cluster link [%v] announce before hello", linker.GetID())
+		return
+	}
+	info := NodeInfo{Name: n.name}
+	info.Addr, _ = msg[0].(string)
+	info.Modules = toStrings(msg[1])
+	info.Pools = toStrings(msg[2])
+	for _, other := range mgr.linkers {
+		if other.name == n.name {
+			other.info = info
+		}
+	}
+	if info.Addr != "" {
+		mgr.peers[n.name] = info.Addr
+	}
+	if peers, ok := msg[3].(map[interface{}]interface{}); ok {
+		for k, v := range peers {
+			node, _ := k.(string)
+			addr, _ := v.(string)
+			if node == "" || addr == "" || node == mgr.name {
+				continue
+			}
+			if _, ok := mgr.peers[node]; !ok {
+				mgr.peers[node] = addr
+			}
+		}
+	}
+	mgr.rebuildServices()
+}
+
+func toStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	s := make([]string, 0, len(list))
+	for _, i := range list {
+		if name, ok := i.(string); ok {
+			s = append(s, name)
+		}
+	}
+	return s
+}
+
+// rebuildServices must be called with the lock held.
+func (mgr *ClusterMgr) rebuildServices() {
+	services := make(map[string][]string)
+	for node, n := range mgr.nodes {
+		for _, name := range n.info.Modules {
+			services[name] = append(services[name], node)
+		}
+		for _, name := range n.info.Pools {
+			services[name] = append(services[name], node)
+		}
+	}
+	for _, nodes := range services {
+		sort.Strings(nodes)
+	}
+	mgr.services = services
+}
+
+func (mgr *ClusterMgr) connectPeers() {
+	if mgr.client == nil {
+		return
+	}
+	for _, p := range mgr.seeds {
+		seeds, err := p.Seeds()
+		if err != nil {
+			slog.LogWarning("cluster", "cluster seeds error: %v", err)
+			continue
+		}
+		mgr.lock.Lock()
+		for node, addr := range seeds {
+			if node != mgr.name {
+				mgr.peers[node] = addr
+			}
+		}
+		mgr.lock.Unlock()
+	}
+
+	dials := make(map[string]string)
+	mgr.lock.Lock()
+	for node, addr := range mgr.peers {
+		if _, ok := mgr.nodes[node]; ok || mgr.connecting[node] || addr == "" {
+			continue
+		}
+		mgr.connecting[node] = true
+		dials[node] = addr
+	}
+	mgr.lock.Unlock()
+
+	for node, addr := range dials {
+		mgr.client.Connect(addr, node)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+const GENERATED_HEADER = "Code generated by einx-gen. DO NOT EDIT."
+
+// generateGo writes the ids, their registration with the codec and the typed
+// handler registration of every msg.
+func generateGo(pkg string, codec string, sources []string, msgs []*protoMsg) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n", GENERATED_HEADER)
+	for _, s := range sources {
+		fmt.Fprintf(&b, "// source: %s\n", s)
+	}
+	fmt.Fprintf(&b, "\npackage %s\n\n", pkg)
+	b.WriteString("import (\n\t\"github.com/jslyzt/einx/module\"\n\t\"github.com/jslyzt/einx/network\"\n)\n\n")
+
+	b.WriteString("const (\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\tID_%s network.ProtoTypeID = %d // %s\n", m.Name, m.ID, m.FullName)
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// MsgNames maps the ids to the proto names.\n")
+	b.WriteString("var MsgNames = map[network.ProtoTypeID]string{\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\tID_%s: %q,\n", m.Name, m.FullName)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("func init() {\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\tnetwork.RegisterMsg(ID_%s, (*%s)(nil), network.%s)\n", m.Name, m.Name, codec)
+	}
+	b.WriteString("}\n")
+
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\nfunc Handle%s(r module.ModuleRouter, f func(module.Context, *%s)) {\n", m.Name, m.Name)
+		fmt.Fprintf(&b, "\tr.RegisterHandler(ID_%s, func(ctx module.Context, msg interface{}) {\n", m.Name)
+		fmt.Fprintf(&b, "\t\tif m, ok := msg.(*%s); ok {\n\t\t\tf(ctx, m)\n\t\t}\n\t})\n}\n", m.Name)
+	}
+	return format.Source(b.Bytes())
+}
+
+// generateLua writes a global table of the ids for lua_state scripts.
+func generateLua(table string, sources []string, msgs []*protoMsg) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "-- %s\n", GENERATED_HEADER)
+	for _, s := range sources {
+		fmt.Fprintf(&b, "-- source: %s\n", s)
+	}
+	fmt.Fprintf(&b, "\n%s = {\n", table)
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\t%s = %d,\n", m.Name, m.ID)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
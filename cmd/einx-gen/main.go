@@ -0,0 +1,118 @@
+// einx-gen assigns stable msg ids to the messages of .proto files and
+// generates their codec registration and typed handler registration for
+// modules, along with a lua table of the ids.
+//
+//	einx-gen -go_out proto/msg_ids.go -lua_out script/msg_ids.lua proto/
+//
+// An id is the fnv-1a hash of the package qualified message name unless it
+// is given with a "// einx:id=N" comment, "// einx:skip" leaves a message
+// out. The output only depends on the inputs and can be checked in.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	goOut    = flag.String("go_out", "", "generated go file")
+	goPkg    = flag.String("go_package", "", "package of the go file, the go_package option by default")
+	codec    = flag.String("codec", "ProtoCodec", "network codec of the messages")
+	luaOut   = flag.String("lua_out", "", "generated lua file")
+	luaTable = flag.String("lua_table", "MsgID", "global lua table of the ids")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: einx-gen [flags] file.proto|dir ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || (*goOut == "" && *luaOut == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "einx-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	paths, err := protoPaths(args)
+	if err != nil {
+		return err
+	}
+
+	var files []*protoFile
+	for _, p := range paths {
+		f, err := parseProtoFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	msgs, err := collectMsgs(files)
+	if err != nil {
+		return err
+	}
+
+	if *goOut != "" {
+		pkg, err := filesGoPackage(files)
+		if err != nil {
+			return err
+		}
+		if *goPkg != "" {
+			pkg = *goPkg
+		}
+		if pkg == "" {
+			return fmt.Errorf("no go_package option, use -go_package")
+		}
+		src, err := generateGo(pkg, *codec, paths, msgs)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*goOut, src, 0644); err != nil {
+			return err
+		}
+	}
+	if *luaOut != "" {
+		if err := ioutil.WriteFile(*luaOut, generateLua(*luaTable, paths, msgs), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoPaths expands the directories to the .proto files they contain and
+// sorts the result.
+func protoPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		err := filepath.Walk(arg, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(p, ".proto") {
+				paths = append(paths, filepath.ToSlash(p))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	uniq := paths[:0]
+	for i, p := range paths {
+		if i == 0 || p != paths[i-1] {
+			uniq = append(uniq, p)
+		}
+	}
+	return uniq, nil
+}
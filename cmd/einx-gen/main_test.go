@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// genFiles runs einx-gen on args and returns the go and lua outputs.
+func genFiles(t *testing.T, args ...string) ([]byte, []byte, error) {
+	dir := t.TempDir()
+	*goOut = filepath.Join(dir, "msg_ids.go")
+	*luaOut = filepath.Join(dir, "msg_ids.lua")
+	defer func() { *goOut, *luaOut = "", "" }()
+	if err := run(args); err != nil {
+		return nil, nil, err
+	}
+	goSrc, err := ioutil.ReadFile(*goOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSrc, err := ioutil.ReadFile(*luaOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return goSrc, luaSrc, nil
+}
+
+func TestGolden(t *testing.T) {
+	goSrc, luaSrc, err := genFiles(t, "testdata/msg")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, g := range []struct {
+		file string
+		got  []byte
+	}{
+		{"testdata/msg_ids.go.golden", goSrc},
+		{"testdata/msg_ids.lua.golden", luaSrc},
+	} {
+		if *update {
+			if err := ioutil.WriteFile(g.file, g.got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(g.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(g.got, want) {
+			t.Errorf("%s differs, run go test -update to accept:\n%s", g.file, g.got)
+		}
+	}
+
+	// the output does not depend on the order of the inputs
+	again, _, err := genFiles(t, "testdata/msg/login.proto", "testdata/msg/chat.proto", "testdata/msg")
+	if err != nil || !bytes.Equal(again, goSrc) {
+		t.Fatalf("output depends on the inputs order: %v", err)
+	}
+}
+
+func TestGoPackageMismatch(t *testing.T) {
+	_, _, err := genFiles(t, "testdata/mixed")
+	if err == nil || !strings.Contains(err.Error(), "go_package") {
+		t.Fatalf("mixed go_package: %v", err)
+	}
+
+	*goPkg = "pb"
+	defer func() { *goPkg = "" }()
+	if _, _, err := genFiles(t, "testdata/mixed"); err == nil {
+		t.Fatalf("mixed go_package accepted with -go_package")
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// directives are line comments right before a top level message,
+// "einx:id=1001" assigns the id instead of hashing the name and
+// "einx:skip" generates nothing for the message.
+const (
+	DIRECTIVE_ID   = "einx:id="
+	DIRECTIVE_SKIP = "einx:skip"
+)
+
+type protoMsg struct {
+	Name     string // go type name
+	Proto    string // proto name
+	FullName string // package qualified proto name
+	ID       uint32
+	Explicit bool
+	Source   string
+}
+
+type protoFile struct {
+	Path      string
+	Package   string
+	GoPackage string
+	Msgs      []*protoMsg
+}
+
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits a proto source in identifiers, strings and symbols, the
+// directives found in comments are kept as tokens.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			comment := strings.TrimSpace(src[i+2 : i+end])
+			if strings.HasPrefix(comment, "einx:") {
+				tokens = append(tokens, token{comment, line})
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+end+4], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{src[i : j+1], line})
+			i = j + 1
+		case isIdent(c):
+			j := i
+			for j < len(src) && (isIdent(src[j]) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{src[i:j], line})
+			i = j
+		default:
+			tokens = append(tokens, token{string(c), line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func parseProtoFile(file string) (*protoFile, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenize(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	pf := &protoFile{Path: file}
+	depth := 0
+	var directives []string
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case strings.HasPrefix(t.text, "einx:"):
+			if depth == 0 {
+				directives = append(directives, t.text)
+			}
+			continue
+		case t.text == "{":
+			depth++
+		case t.text == "}":
+			depth--
+		case depth == 0 && t.text == "package" && i+1 < len(tokens):
+			pf.Package = tokens[i+1].text
+		case depth == 0 && t.text == "option" && i+3 < len(tokens) && tokens[i+1].text == "go_package":
+			v, err := strconv.Unquote(tokens[i+3].text)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad go_package", file, t.line)
+			}
+			pf.GoPackage = v
+		case depth == 0 && t.text == "message" && i+1 < len(tokens):
+			msg, err := newProtoMsg(file, tokens[i+1], directives)
+			if err != nil {
+				return nil, err
+			}
+			if msg != nil {
+				pf.Msgs = append(pf.Msgs, msg)
+			}
+		}
+		directives = directives[:0]
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%s: unbalanced braces", file)
+	}
+	for _, m := range pf.Msgs {
+		m.FullName = m.Proto
+		if pf.Package != "" {
+			m.FullName = pf.Package + "." + m.Proto
+		}
+		if !m.Explicit {
+			m.ID = hashID(m.FullName)
+		}
+	}
+	return pf, nil
+}
+
+func newProtoMsg(file string, name token, directives []string) (*protoMsg, error) {
+	msg := &protoMsg{
+		Name:   goCamelCase(name.text),
+		Proto:  name.text,
+		Source: fmt.Sprintf("%s:%d", file, name.line),
+	}
+	for _, d := range directives {
+		switch {
+		case d == DIRECTIVE_SKIP:
+			return nil, nil
+		case strings.HasPrefix(d, DIRECTIVE_ID):
+			id, err := strconv.ParseUint(strings.TrimPrefix(d, DIRECTIVE_ID), 0, 32)
+			if err != nil || id == 0 {
+				return nil, fmt.Errorf("%s: bad directive %q", msg.Source, d)
+			}
+			msg.ID = uint32(id)
+			msg.Explicit = true
+		}
+	}
+	return msg, nil
+}
+
+// hashID derives the id from the qualified name so that it does not depend
+// on the order of the files or of the messages, nor on other teams.
+func hashID(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	id := h.Sum32()
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// goCamelCase follows the names protoc-gen-go gives to message types.
+func goCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' && i == 0:
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// goPackageName is the package name of a go_package option.
+func goPackageName(goPackage string) string {
+	if i := strings.IndexByte(goPackage, ';'); i >= 0 {
+		return goPackage[i+1:]
+	}
+	return strings.Replace(path.Base(goPackage), "-", "_", -1)
+}
+
+// filesGoPackage is the package name of the go_package option shared by
+// files, the generated file cannot hold the msgs of several packages.
+func filesGoPackage(files []*protoFile) (string, error) {
+	var from *protoFile
+	for _, f := range files {
+		if f.GoPackage == "" {
+			continue
+		}
+		if from != nil && f.GoPackage != from.GoPackage {
+			return "", fmt.Errorf("%s: go_package %q differs from %q of %s",
+				f.Path, f.GoPackage, from.GoPackage, from.Path)
+		}
+		from = f
+	}
+	if from == nil {
+		return "", nil
+	}
+	return goPackageName(from.GoPackage), nil
+}
+
+// collectMsgs sorts the msgs of files by name and checks the ids.
+func collectMsgs(files []*protoFile) ([]*protoMsg, error) {
+	var msgs []*protoMsg
+	for _, f := range files {
+		msgs = append(msgs, f.Msgs...)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].FullName < msgs[j].FullName
+	})
+
+	ids := make(map[uint32]*protoMsg)
+	names := make(map[string]*protoMsg)
+	for _, m := range msgs {
+		if o, ok := names[m.Name]; ok {
+			return nil, fmt.Errorf("%s: message %s already declared at %s", m.Source, m.Name, o.Source)
+		}
+		names[m.Name] = m
+		if o, ok := ids[m.ID]; ok {
+			return nil, fmt.Errorf("%s: id %d of %s collides with %s at %s, assign one with // %s",
+				m.Source, m.ID, m.FullName, o.FullName, o.Source, DIRECTIVE_ID)
+		}
+		ids[m.ID] = m
+	}
+	return msgs, nil
+}
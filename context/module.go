@@ -7,11 +7,17 @@ import (
 type (
 	TimerHandler = timer.TimerHandler
 
+	// RpcCallback receives the reply of Module.Call in the caller module's event loop.
+	RpcCallback func(ctx Context, reply []interface{}, err error)
+
 	Module interface {
 		GetID() AgentID
 		GetName() string
 		RpcCall(string, ...interface{})
 		AwaitRpcCall(string, ...interface{}) []interface{}
+		// Call must be called in the goroutine of the caller module, it registers
+		// the reply callback on the caller without a lock.
+		Call(caller Module, name string, timeout uint64, cb RpcCallback, args ...interface{})
 		AddTimer(delay uint64, op TimerHandler, args ...interface{}) uint64
 		RemoveTimer(timer_id uint64) bool
 	}
@@ -69,7 +69,7 @@ func (mgr *MongoDBMgr) Close() {
 		mgr.session.DB("").Logout()
 		mgr.session.Close()
 		mgr.session = nil
-		slog.LogInfo("mongodb", "Disconnect mongodb url: ", mgr.dbcfg.String())
+		slog.LogInfo("mongodb", "Disconnect mongodb url: %s", mgr.dbcfg.String())
 	}
 }
 
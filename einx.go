@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/jslyzt/einx/agent"
+	"github.com/jslyzt/einx/cluster"
 	"github.com/jslyzt/einx/component"
 	"github.com/jslyzt/einx/context"
 	"github.com/jslyzt/einx/event"
@@ -23,30 +24,64 @@ type (
 	ArgsVar          = module.ArgsVar
 	MsgHandler       = module.MsgHandler
 	RpcHandler       = module.RpcHandler
+	RpcCallback      = module.RpcCallback
 	WorkerPool       = module.WorkerPool
 	Component        = component.Component
 	ComponentID      = component.ComponentID
 	ModuleRouter     = module.ModuleRouter
 	ComponentMgr     = module.ComponentMgr
+	GroupMgr         = module.GroupMgr
+	CodecHandler     = module.CodecHandler
+	SessionGroup     = module.SessionGroup
+	Actor            = module.Actor
+	ActorID          = module.ActorID
+	ActorSpec        = module.ActorSpec
+	ActorHandler     = module.ActorHandler
 	SessionEventMsg  = event.SessionEventMsg
 	LuaRuntime       = lua_state.LuaRuntime
 	NetLinker        = network.NetLinker
+	BroadcastMsg     = network.BroadcastMsg
+	Codec            = network.Codec
 	ProtoTypeID      = network.ProtoTypeID
 	SessionMgr       = network.SessionMgr
+	ReconnectMgr     = network.ReconnectMgr
+	DrainMgr         = network.DrainMgr
 	SessionHandler   = network.SessionHandler
 	ITcpClientMgr    = network.ITcpClientMgr
 	ITcpServerMgr    = network.ITcpServerMgr
 	TimerHandler     = timer.TimerHandler
 	EventReceiver    = event.EventReceiver
 	ITranMsgMultiple = network.ITranMsgMultiple
+	ClusterMgr       = cluster.ClusterMgr
+	RemoteNode       = cluster.RemoteNode
+	NodeInfo         = cluster.NodeInfo
+	SeedProvider     = cluster.SeedProvider
+	StaticSeeds      = cluster.StaticSeeds
+	FileSeeds        = cluster.FileSeeds
+	RateStats        = network.RateStats
 
 	einx struct {
-		endWait   sync.WaitGroup
-		closeChan chan bool
-		onClose   func()
+		endWait      sync.WaitGroup
+		closeChan    chan bool
+		onClose      func()
+		drainTimeout int64
 	}
 )
 
+const (
+	COMPRESS_FLATE = network.PACKET_FLAG_FLATE
+	COMPRESS_ZLIB  = network.PACKET_FLAG_ZLIB
+
+	LIMIT_ACTION_DELAY = network.LIMIT_ACTION_DELAY
+	LIMIT_ACTION_DROP  = network.LIMIT_ACTION_DROP
+	LIMIT_ACTION_CLOSE = network.LIMIT_ACTION_CLOSE
+
+	WRITE_POLICY_BLOCK       = network.WRITE_POLICY_BLOCK
+	WRITE_POLICY_DROP_NEWEST = network.WRITE_POLICY_DROP_NEWEST
+	WRITE_POLICY_DROP_OLDEST = network.WRITE_POLICY_DROP_OLDEST
+	WRITE_POLICY_DISCONNECT  = network.WRITE_POLICY_DISCONNECT
+)
+
 func (e *einx) doClose() {
 	onClose := e.onClose
 	if onClose != nil {
@@ -56,6 +91,9 @@ func (e *einx) doClose() {
 }
 
 func (e *einx) close() {
+	if e.drainTimeout > 0 {
+		network.Drain(e.drainTimeout)
+	}
 	module.Close()
 	e.endWait.Wait()
 }
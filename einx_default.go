@@ -5,6 +5,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/jslyzt/einx/cluster"
 	"github.com/jslyzt/einx/console"
 	"github.com/jslyzt/einx/event"
 	lua_state "github.com/jslyzt/einx/lua"
@@ -24,10 +25,17 @@ func Init(opts ...Option) {
 	}
 }
 
+// Run starts the modules and waits for a shutdown signal. When the modules
+// fail to start, the ones started are stopped with their servers and the
+// process exits with status 1.
 func Run() {
 	console.Run()
 	network.Run()
-	module.Start()
+	if err := module.Start(); err != nil {
+		slog.LogError("einx", "einx start failed: %v", err)
+		slog.Close()
+		os.Exit(1)
+	}
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	sig := <-c
@@ -84,6 +92,72 @@ func StartTcpClientMgr(m module.Module, name string, mgr interface{}, opts ...Op
 	er.PushEventMsg(e)
 }
 
+// AddWsServerMgr serves websocket linkers on addr, they are reported to mgr like tcp linkers.
+func AddWsServerMgr(m module.Module, addr string, mgr interface{}, opts ...Option) {
+	er := m.(event.EventReceiver)
+
+	opts = append(opts, NetworkOption.ListenAddr(addr))
+	opts = append(opts, network.Module(er))
+	opts = append(opts, NetworkOption.ServeHandler(mgr.(SessionHandler)))
+
+	wsServer := network.NewWsServerMgr(opts...)
+
+	e := &event.ComponentEventMsg{}
+	e.MsgType = event.EVENT_COMPONENT_CREATE
+	e.Sender = wsServer
+	e.Attach = mgr
+	er.PushEventMsg(e)
+}
+
+func StartWsClientMgr(m module.Module, name string, mgr interface{}, opts ...Option) {
+	er := m.(event.EventReceiver)
+
+	opts = append(opts, NetworkOption.Name(name))
+	opts = append(opts, network.Module(er))
+	opts = append(opts, NetworkOption.ServeHandler(mgr.(SessionHandler)))
+
+	wsClient := network.NewWsClientMgr(opts...)
+
+	e := &event.ComponentEventMsg{}
+	e.MsgType = event.EVENT_COMPONENT_CREATE
+	e.Sender = wsClient
+	e.Attach = mgr
+	er.PushEventMsg(e)
+}
+
+// AddUdpServerMgr serves reliable udp linkers on addr, they are reported to mgr like tcp linkers.
+func AddUdpServerMgr(m module.Module, addr string, mgr interface{}, opts ...Option) {
+	er := m.(event.EventReceiver)
+
+	opts = append(opts, NetworkOption.ListenAddr(addr))
+	opts = append(opts, network.Module(er))
+	opts = append(opts, NetworkOption.ServeHandler(mgr.(SessionHandler)))
+
+	udpServer := network.NewUdpServerMgr(opts...)
+
+	e := &event.ComponentEventMsg{}
+	e.MsgType = event.EVENT_COMPONENT_CREATE
+	e.Sender = udpServer
+	e.Attach = mgr
+	er.PushEventMsg(e)
+}
+
+func StartUdpClientMgr(m module.Module, name string, mgr interface{}, opts ...Option) {
+	er := m.(event.EventReceiver)
+
+	opts = append(opts, NetworkOption.Name(name))
+	opts = append(opts, network.Module(er))
+	opts = append(opts, NetworkOption.ServeHandler(mgr.(SessionHandler)))
+
+	udpClient := network.NewUdpClientMgr(opts...)
+
+	e := &event.ComponentEventMsg{}
+	e.MsgType = event.EVENT_COMPONENT_CREATE
+	e.Sender = udpClient
+	e.Attach = mgr
+	er.PushEventMsg(e)
+}
+
 func AddModuleComponent(m module.Module, c Component, mgr interface{}) {
 	er := m.(event.EventReceiver)
 	e := &event.ComponentEventMsg{}
@@ -100,3 +174,42 @@ func CreateModuleWorkers(name string, size int) WorkerPool {
 func GetWorkerPool(name string) WorkerPool {
 	return module.GetWorkerPool(name)
 }
+
+// StartModule starts a module or worker pool created while einx is running.
+func StartModule(name string) error {
+	return module.StartModule(name)
+}
+
+// RemoveModule stops a module or worker pool and unregisters it.
+func RemoveModule(name string) error {
+	return module.RemoveModule(name)
+}
+
+func SpawnActor(host Module, id ActorID, spec *ActorSpec, attach interface{}) (*Actor, error) {
+	return module.SpawnActor(host, id, spec, attach)
+}
+
+func FindActor(id ActorID) *Actor {
+	return module.FindActor(id)
+}
+
+// AddCluster hosts the cluster node [node] in module m, listening on addr
+// (empty for client only nodes) and connecting to the nodes given by seeds.
+func AddCluster(m module.Module, node string, addr string, seeds cluster.SeedProvider, opts ...Option) *ClusterMgr {
+	mgr := cluster.NewClusterMgr(node)
+	mgr.SetAddr(addr)
+	if seeds != nil {
+		mgr.AddSeeds(seeds)
+	}
+	// links between nodes are trusted, they are not rate limited unless opts say so
+	opts = append([]Option{NetworkOption.TransportMaxCount(0)}, opts...)
+	if addr != "" {
+		AddTcpServerMgr(m, addr, mgr, opts...)
+	}
+	StartTcpClientMgr(m, "cluster_"+node, mgr, opts...)
+	return mgr
+}
+
+func ClusterCall(caller Module, path string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	cluster.Call(caller, path, timeout, cb, args...)
+}
@@ -27,6 +27,11 @@ const (
 	EVENT_COMPONENT_CREATE
 	EVENT_COMPONENT_ERROR
 	EVENT_COMPONENT_CUSTOM
+	EVENT_MODULE_RPC_REPLY
+	EVENT_TCP_RECONNECTING
+	EVENT_TCP_RECONNECTED
+	EVENT_TCP_DRAINING
+	EVENT_ACTOR_MSG
 )
 
 type EventMsg interface {
@@ -105,6 +110,7 @@ type RpcEventMsg struct {
 	Sender  Agent
 	RpcName string
 	Data    []interface{}
+	Session uint64
 }
 
 func (m *RpcEventMsg) GetType() EventType {
@@ -120,6 +126,31 @@ func (m *RpcEventMsg) Reset() {
 	m.Sender = nil
 	m.RpcName = ""
 	m.Data = nil
+	m.Session = 0
+}
+
+type RpcReplyEventMsg struct {
+	MsgType EventType
+	Sender  Agent
+	Session uint64
+	Data    []interface{}
+	Err     error
+}
+
+func (m *RpcReplyEventMsg) GetType() EventType {
+	return m.MsgType
+}
+
+func (m *RpcReplyEventMsg) GetSender() Agent {
+	return m.Sender
+}
+
+func (m *RpcReplyEventMsg) Reset() {
+	m.MsgType = 0
+	m.Sender = nil
+	m.Session = 0
+	m.Data = nil
+	m.Err = nil
 }
 
 type CustomActionEventMsg interface {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/jslyzt/einx/network"
 	"github.com/jslyzt/einx/slog"
 	lua "github.com/jslyzt/glua"
 )
@@ -201,7 +202,12 @@ func (rtm *LuaRuntime) RegisterFunction(s string, f func(*lua.LState) int) {
 	l.SetGlobal(s, l.NewFunction(f))
 }
 
+// Marshal appends lv to b in the rpc value format of the network package.
 func Marshal(b []byte, lv lua.LValue) []byte {
+	return marshalValue(append(b, network.RPC_FORMAT_VERSION), lv)
+}
+
+func marshalValue(b []byte, lv lua.LValue) []byte {
 	var buffer []byte = nil
 	switch v := lv.(type) {
 	case *lua.LNilType:
@@ -239,13 +245,13 @@ func Marshal(b []byte, lv lua.LValue) []byte {
 		if maxn == 0 {
 			buffer = append(b, '[')
 			v.ForEach(func(key, value lua.LValue) {
-				buffer = Marshal(Marshal(buffer, key), value)
+				buffer = marshalValue(marshalValue(buffer, key), value)
 			})
 			buffer = append(buffer, ']')
 		} else {
 			buffer = append(b, '{')
 			for i := 1; i <= maxn; i++ {
-				buffer = Marshal(buffer, v.RawGetInt(i))
+				buffer = marshalValue(buffer, v.RawGetInt(i))
 			}
 			buffer = append(buffer, '}')
 		}
@@ -256,89 +262,49 @@ func Marshal(b []byte, lv lua.LValue) []byte {
 	return buffer
 }
 
+// UnMarshal decodes the rpc value format of the network package, it returns
+// nil and b for a malformed value.
 func UnMarshal(b []byte, l *lua.LState) (lua.LValue, []byte) {
-	if len(b) < 1 {
+	v, rest, err := network.RpcDecode(b)
+	if err != nil {
+		slog.LogWarning("lua", "error:unmarshal %v", err)
 		return lua.LNil, b
 	}
-	t := b[0]
-	switch t {
-	case 'z':
-		return lua.LNil, b[1:]
-	case 't':
-		return lua.LBool(true), b[1:]
-	case 'f':
-		return lua.LBool(false), b[1:]
-	case 's':
-		if len(b) < 5 {
-			slog.LogWarning("lua", "error:unknow unmarshal string")
-			return lua.LNil, b
-		}
-		slen := uint32(b[1]) | uint32(b[2])<<8 | uint32(b[3])<<16 | uint32(b[4])<<24
-		return lua.LString(b[5 : 5+slen]), b[5+slen:]
-	case 'd':
-		if len(b) < 9 {
-			slog.LogWarning("lua", "error:unknow unmarshal number")
-			return lua.LNil, b
-		}
-		n := uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16 | uint64(b[4])<<24 |
-			uint64(b[5])<<32 | uint64(b[6])<<40 | uint64(b[7])<<48 | uint64(b[8])<<56
-		return lua.LNumber(math.Float64frombits(n)), b[9:]
-	case 'i':
-		length := len(b)
-		if length < 2 {
-			slog.LogWarning("lua", "error:unknow unmarshal varint")
-			return lua.LNil, b
-		}
-		var ux uint64
-		var s uint32
-		i := 1
-		for ; i < 9; i++ {
-			if i >= length {
-				slog.LogWarning("lua", "error:unknow unmarshal varint:overflow")
-				return lua.LNil, b
-			}
-			m := b[i]
-			if m < 0x80 {
-				if i == 9 && m > 1 {
-					slog.LogWarning("lua", "error:unknow unmarshal varint:overflow")
-					return lua.LNil, b
-				}
-				ux |= uint64(m) << s
-				break
-			}
-			ux |= uint64(m&0x7f) << s
-			s += 7
-		}
-		x := int64(ux >> 1)
-		if ux&1 != 0 {
-			x = ^x
-		}
-		return lua.LNumber(x), b[i+1:]
-	case '[':
-		var key lua.LValue
-		var val lua.LValue
-		tb := b[1:]
+	return rpcValue(l, v), rest
+}
+
+func rpcValue(l *lua.LState, val interface{}) lua.LValue {
+	switch v := val.(type) {
+	case int8:
+		return lua.LNumber(v)
+	case uint8:
+		return lua.LNumber(v)
+	case int16:
+		return lua.LNumber(v)
+	case uint16:
+		return lua.LNumber(v)
+	case uint:
+		return lua.LNumber(v)
+	case []interface{}:
 		lt := l.NewTable()
-		for tb[0] != ']' {
-			key, tb = UnMarshal(tb, l)
-			val, tb = UnMarshal(tb, l)
-			lt.RawSet(key, val)
+		for k, m := range v {
+			lt.RawSetInt(k+1, rpcValue(l, m))
 		}
-		return lt, tb[1:]
-	case '{':
-		var val lua.LValue
-		index := 1
-		tb := b[1:]
+		return lt
+	case map[interface{}]interface{}:
 		lt := l.NewTable()
-		for tb[0] != '}' {
-			val, tb = UnMarshal(tb, l)
-			lt.RawSetInt(index, val)
-			index++
+		for k, m := range v {
+			key := rpcValue(l, k)
+			if key == lua.LNil {
+				continue
+			}
+			lt.RawSet(key, rpcValue(l, m))
 		}
-		return lt, tb[1:]
+		return lt
 	default:
-		slog.LogError("lua", "error lua type %v", t)
-		//panic("error lua type")
+		if lv := convertValue(l, v); lv != nil {
+			return lv
+		}
+		return lua.LNil
 	}
-	return lua.LNil, b
 }
@@ -4,6 +4,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jslyzt/einx/agent"
@@ -25,14 +26,19 @@ type ComponentEventMsg = event.ComponentEventMsg
 type SessionEventMsg = event.SessionEventMsg
 type DataEventMsg = event.DataEventMsg
 type RpcEventMsg = event.RpcEventMsg
+type RpcReplyEventMsg = event.RpcReplyEventMsg
 type AwaitRpcEventMsg = event.AwaitRpcEventMsg
 type CustomActionEventMsg = event.CustomActionEventMsg
 type EventQueue = event.EventQueue
 type TimerHandler = timer.TimerHandler
 type TimerManager = timer.TimerManager
 type SessionMgr = network.SessionMgr
+type ReconnectMgr = network.ReconnectMgr
+type DrainMgr = network.DrainMgr
 type Module = context.Module
 type Context = context.Context
+type RpcCallback = context.RpcCallback
+type EventReceiver = event.EventReceiver
 type ProtoTypeID = uint32
 type MsgHandler func(Context, interface{})
 type RpcHandler func(Context, *ArgsVar)
@@ -40,6 +46,7 @@ type RpcHandler func(Context, *ArgsVar)
 type ModuleRouter interface {
 	RouterMsg(Agent, ProtoTypeID, interface{})
 	RouterRpc(Agent, string, []interface{})
+	RouterCall(Agent, uint64, string, []interface{})
 	RegisterHandler(ProtoTypeID, MsgHandler)
 	RegisterRpcHandler(string, RpcHandler)
 }
@@ -63,13 +70,27 @@ type module struct {
 	agentMap      map[AgentID]Agent
 	commgrMap     map[ComponentID]ComponentMgr
 	componentMap  map[ComponentID]Component
+	groupMap      map[string]*SessionGroup
+	agentGroups   map[AgentID][]*SessionGroup
+	actorMap      map[ActorID]*Actor
 	awaitMsgPool  *sync.Pool
 	rpcMsgPool    *sync.Pool
 	dataMsgPool   *sync.Pool
 	eventMsgPool  *sync.Pool
 	timerManager  *TimerManager
+	rpcCallMap    map[uint64]*rpcCall
+	rpcSession    uint64
 	opCount       int64
 	closeChan     chan bool
+	exitChan      chan struct{}
+	closing       bool
+	exited        int32
+	pushing       int32
+	pool          string
+	curEvent      EventMsg
+	curCtx        *ModuleContext // the context replying to curEvent
+	supervisor    supervisorState
+	stats         SupervisorStats
 	context       *ModuleContext
 	args          ArgsVar
 	eventList     []interface{}
@@ -86,11 +107,27 @@ func (m *module) GetName() string {
 	return m.name
 }
 func (m *module) PushEventMsg(ev EventMsg) {
+	m.push(ev)
+}
+
+// push queues ev unless the module exited, then ev is dropped as the pending
+// events are when the module closes.
+func (m *module) push(ev EventMsg) {
+	atomic.AddInt32(&m.pushing, 1)
+	if atomic.LoadInt32(&m.exited) != 0 {
+		atomic.AddInt32(&m.pushing, -1)
+		m.dropEvent(ev, ErrModuleClosed)
+		return
+	}
 	m.evQueue.Push(ev)
+	atomic.AddInt32(&m.pushing, -1)
 }
 
 func (m *module) Close() {
-	m.closeChan <- true
+	select {
+	case m.closeChan <- true:
+	case <-m.exitChan:
+	}
 	slog.LogWarning("module", "module [%s] will close!", m.name)
 }
 
@@ -108,7 +145,7 @@ func (m *module) PostEvent(eventType EventType, agent Agent, cid ComponentID, ar
 	e.Sender = agent
 	e.Cid = cid
 	e.Args = args
-	m.evQueue.Push(e)
+	m.push(e)
 }
 
 func (m *module) PostData(eventType EventType, typeID ProtoTypeID, agent Agent, data interface{}) {
@@ -117,7 +154,7 @@ func (m *module) PostData(eventType EventType, typeID ProtoTypeID, agent Agent,
 	event.Sender = agent
 	event.TypeID = typeID
 	event.MsgData = data
-	m.evQueue.Push(event)
+	m.push(event)
 }
 
 func (m *module) RpcCall(name string, args ...interface{}) {
@@ -126,7 +163,7 @@ func (m *module) RpcCall(name string, args ...interface{}) {
 	rpc_msg.Sender = m
 	rpc_msg.Data = args
 	rpc_msg.RpcName = name
-	m.evQueue.Push(rpc_msg)
+	m.push(rpc_msg)
 }
 
 func (m *module) AwaitRpcCall(name string, args ...interface{}) []interface{} {
@@ -135,9 +172,25 @@ func (m *module) AwaitRpcCall(name string, args ...interface{}) []interface{} {
 	rpc_msg.Sender = m
 	rpc_msg.Data = args
 	rpc_msg.RpcName = name
-	rpc_msg.Await = make(chan []interface{})
-	m.evQueue.Push(rpc_msg)
-	return <-rpc_msg.Await
+	await := make(chan []interface{}, 1) // the reply never blocks the module
+	rpc_msg.Await = await                // rpc_msg is reset once handled
+	m.push(rpc_msg)
+	return <-await
+}
+
+func (m *module) Call(caller Module, name string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	c, ok := caller.(rpcCaller)
+	if !ok {
+		slog.LogError("module", "module [%v] rpc [%v] call from unsupported caller [%v]", m.name, name, caller)
+		return
+	}
+	rpc_msg := m.rpcMsgPool.Get().(*RpcEventMsg)
+	rpc_msg.MsgType = event.EVENT_MODULE_RPC
+	rpc_msg.Sender = c
+	rpc_msg.Data = args
+	rpc_msg.RpcName = name
+	rpc_msg.Session = c.addRpcCall(cb, timeout)
+	m.push(rpc_msg)
 }
 
 func (m *module) RouterMsg(agent Agent, msgID ProtoTypeID, msg interface{}) {
@@ -150,7 +203,17 @@ func (m *module) RouterRpc(agent Agent, name string, args []interface{}) {
 	rpc_msg.Sender = agent
 	rpc_msg.Data = args
 	rpc_msg.RpcName = name
-	m.evQueue.Push(rpc_msg)
+	m.push(rpc_msg)
+}
+
+func (m *module) RouterCall(agent Agent, session uint64, name string, args []interface{}) {
+	rpc_msg := m.rpcMsgPool.Get().(*RpcEventMsg)
+	rpc_msg.MsgType = event.EVENT_MODULE_RPC
+	rpc_msg.Sender = agent
+	rpc_msg.Data = args
+	rpc_msg.RpcName = name
+	rpc_msg.Session = session
+	m.push(rpc_msg)
 }
 
 func (m *module) RegisterHandler(typeID ProtoTypeID, handler MsgHandler) {
@@ -171,20 +234,29 @@ func (m *module) RegisterRpcHandler(rpcName string, handler RpcHandler) {
 	m.rpcHandlerMap[rpcName] = handler
 }
 
-func (m *module) recover(wait *sync.WaitGroup) {
-	if r := recover(); r != nil {
-		slog.LogError("module_recovery", "recover error :%v", r)
-		slog.LogError("module_recovery", "%s", string(debug.Stack()))
-		go m.Run(wait) // continue to run
-	}
-}
-
+// Run runs the event loop until the module is closed, a panic is handled by
+// the supervisor of the module in the same goroutine.
+// Run is the event loop of the module, the caller adds it to wait before
+// starting its goroutine.
 func (m *module) Run(wait *sync.WaitGroup) {
 	runtime.LockOSThread()
-	defer m.recover(wait)
-	wait.Add(1)
 	defer wait.Done()
 	m.beginTime = time.Now().UnixNano() / 1e9
+	for !m.closing && !m.loop() {
+		if !m.supervise() {
+			break
+		}
+	}
+	m.doClose(wait)
+}
+
+// loop returns true when the module is closed and false after a panic.
+func (m *module) loop() (closed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.onPanic(r, debug.Stack())
+		}
+	}()
 	timerManager := m.timerManager
 	var (
 		eventMsg  EventMsg = nil
@@ -207,7 +279,9 @@ func (m *module) Run(wait *sync.WaitGroup) {
 				eventMsg = eventList[m.eventIndex].(EventMsg)
 				eventList[m.eventIndex] = nil
 				m.eventIndex++
+				m.curEvent = eventMsg
 				m.handleEvent(eventMsg)
+				m.curEvent, m.curCtx = nil, nil
 				m.opCount++
 			}
 			nextWake = timerManager.Execute(100)
@@ -224,7 +298,8 @@ func (m *module) Run(wait *sync.WaitGroup) {
 		select {
 		case closeFlag = <-m.closeChan:
 			if closeFlag {
-				goto runClose
+				timerTick.Stop()
+				return true
 			}
 		case <-eventChan:
 		case <-tickC:
@@ -232,12 +307,10 @@ func (m *module) Run(wait *sync.WaitGroup) {
 
 		evQueue.WaiterWake()
 	}
-
-runClose:
-	m.doClose(wait)
 }
 
 func (m *module) doClose(wait *sync.WaitGroup) {
+	m.stopActors()
 	for _, c := range m.componentMap {
 		c.Close()
 	}
@@ -248,6 +321,12 @@ func (m *module) doClose(wait *sync.WaitGroup) {
 		elaspTime := time.Now().UnixNano()/1e9 - m.beginTime
 		slog.LogError("perfomance", "module perfomance [%s] %d %d %d", m.name, elaspTime, m.opCount, m.opCount/elaspTime)
 	}
+	atomic.StoreInt32(&m.exited, 1)
+	for atomic.LoadInt32(&m.pushing) != 0 {
+		runtime.Gosched()
+	}
+	m.drainEvents()
+	close(m.exitChan)
 	//slog.LogWarning("module", "module [%s] closed!", m.name)
 }
 
@@ -263,14 +342,24 @@ func (m *module) handleEvent(eventMsg EventMsg) {
 		m.handleAgentEnter(eventMsg)
 	case event.EVENT_TCP_CONNECTED:
 		m.handleAgentEnter(eventMsg)
+	case event.EVENT_TCP_RECONNECTED:
+		m.handleAgentEnter(eventMsg)
+	case event.EVENT_TCP_RECONNECTING:
+		m.handleAgentReconnecting(eventMsg)
+	case event.EVENT_TCP_DRAINING:
+		m.handleAgentDraining(eventMsg)
 	case event.EVENT_TCP_CLOSED:
 		m.handleAgentClosed(eventMsg)
 	case event.EVENT_MODULE_RPC:
 		m.handleRpc(eventMsg)
 	case event.EVENT_MODULE_AWAITRPC:
 		m.handleAwaitRpc(eventMsg)
+	case event.EVENT_MODULE_RPC_REPLY:
+		m.handleRpcReply(eventMsg)
 	case event.EVENT_COMPONENT_CUSTOM:
 		m.handleCustomAction(eventMsg)
+	case event.EVENT_ACTOR_MSG:
+		m.handleActorMsg(eventMsg)
 	default:
 		slog.LogError("einx", "handleEvent unknow event msg [%v]", eventMsg.GetType())
 	}
@@ -287,6 +376,9 @@ func (m *module) handleDataEvent(eventMsg EventMsg) {
 	} else {
 		slog.LogError("module", "module [%s] unregister msg handler msg type id[%d] %v!", m.name, dataEventMsg.TypeID, ok)
 	}
+	if mb, ok := dataEventMsg.MsgData.(*network.MsgBuffer); ok {
+		mb.Release() // handlers Retain the buffers they keep
+	}
 	eventMsg.Reset()
 	m.dataMsgPool.Put(eventMsg)
 }
@@ -327,6 +419,10 @@ func (m *module) handleAgentEnter(eventMsg EventMsg) {
 	m.agentMap[a.GetID()] = a
 
 	if sesMgr, ok := m.commgrMap[s.Cid]; ok {
+		if r, ok := sesMgr.(ReconnectMgr); ok && s.MsgType == event.EVENT_TCP_RECONNECTED {
+			r.OnLinkerReconnected(a.GetID(), a)
+			return
+		}
 		sesMgr.(SessionMgr).OnLinkerConnected(a.GetID(), a)
 		return
 	}
@@ -334,10 +430,47 @@ func (m *module) handleAgentEnter(eventMsg EventMsg) {
 	slog.LogError("agent", "module[%v] agent enter not found pakage[%v]", m.name, s.Cid)
 }
 
+func (m *module) handleAgentReconnecting(eventMsg EventMsg) {
+	s := eventMsg.(*SessionEventMsg)
+	if len(s.Args) < 4 {
+		return
+	}
+	name, _ := s.Args[0].(string)
+	attempt, _ := s.Args[2].(int)
+	err, _ := s.Args[3].(error)
+	if sesMgr, ok := m.commgrMap[s.Cid]; ok {
+		if r, ok := sesMgr.(ReconnectMgr); ok {
+			r.OnLinkerReconnecting(name, s.Args[1], attempt, err)
+			return
+		}
+	}
+	slog.LogWarning("agent", "module[%v] link [%v] reconnecting attempt %d: %v", m.name, name, attempt, err)
+}
+
+func (m *module) handleAgentDraining(eventMsg EventMsg) {
+	s := eventMsg.(*SessionEventMsg)
+	a := s.Sender
+	if sesMgr, ok := m.commgrMap[s.Cid]; ok {
+		if d, ok := sesMgr.(DrainMgr); ok {
+			d.OnLinkerDraining(a.GetID(), a)
+		}
+	}
+	deadline := time.Now()
+	if len(s.Args) > 0 {
+		deadline, _ = s.Args[0].(time.Time)
+	}
+	if d, ok := a.(network.Drainer); ok {
+		d.Drain(deadline)
+	} else {
+		a.Close()
+	}
+}
+
 func (m *module) handleAgentClosed(eventMsg EventMsg) {
 	s := eventMsg.(*SessionEventMsg)
 	sender := s.Sender
 	delete(m.agentMap, sender.GetID())
+	m.leaveGroups(sender.GetID())
 	if sesMgr, ok := m.commgrMap[s.Cid]; ok {
 		var err error = nil
 		if len(s.Args) > 0 {
@@ -353,15 +486,27 @@ func (m *module) handleAgentClosed(eventMsg EventMsg) {
 func (m *module) handleRpc(eventMsg EventMsg) {
 	rpcMsg := eventMsg.(*RpcEventMsg)
 	if handler, ok := m.rpcHandlerMap[rpcMsg.RpcName]; ok {
-		ctx := m.context
 		args := &m.args
-		ctx.s = rpcMsg.Sender
 		args.ref(rpcMsg.Data)
-		handler(ctx, args)
+		if rpcMsg.Session != 0 {
+			// the handler may keep the context and reply later
+			ctx := &ModuleContext{m: m}
+			ctx.s = rpcMsg.Sender
+			ctx.q = rpcMsg.Session
+			m.curCtx = ctx
+			handler(ctx, args)
+		} else {
+			ctx := m.context
+			ctx.s = rpcMsg.Sender
+			handler(ctx, args)
+			ctx.Reset()
+		}
 		args.clear()
-		ctx.Reset()
 	} else {
 		slog.LogError("module", "module [%v] unregister rpc handler! rpc name:[%v]", m.name, rpcMsg.RpcName)
+		if rpcMsg.Session != 0 {
+			replyRpc(m, rpcMsg.Sender, rpcMsg.Session, nil, ErrRpcNoHandler)
+		}
 	}
 	eventMsg.Reset()
 	m.rpcMsgPool.Put(rpcMsg)
@@ -370,20 +515,36 @@ func (m *module) handleRpc(eventMsg EventMsg) {
 func (m *module) handleAwaitRpc(eventMsg EventMsg) {
 	rpcMsg := eventMsg.(*AwaitRpcEventMsg)
 	if handler, ok := m.rpcHandlerMap[rpcMsg.RpcName]; ok {
-		ctx := &ModuleContext{}
+		ctx := &ModuleContext{m: m}
 		args := &m.args
 		ctx.s = rpcMsg.Sender
 		ctx.u = rpcMsg.Await
 		args.ref(rpcMsg.Data)
+		m.curCtx = ctx
 		handler(ctx, args)
 		args.clear()
 	} else {
 		slog.LogError("module", "module [%v] unregister rpc handler! rpc name:[%v]", m.name, rpcMsg.RpcName)
+		rpcMsg.Await <- []interface{}{ErrRpcNoHandler} // AwaitRpcCall gets the error after the results
 	}
 	eventMsg.Reset()
 	m.awaitMsgPool.Put(rpcMsg)
 }
 
+func (m *module) handleRpcReply(eventMsg EventMsg) {
+	replyMsg := eventMsg.(*RpcReplyEventMsg)
+	call, ok := m.rpcCallMap[replyMsg.Session]
+	if !ok {
+		slog.LogWarning("module", "module [%v] rpc reply session [%v] expired", m.name, replyMsg.Session)
+		return
+	}
+	delete(m.rpcCallMap, replyMsg.Session)
+	if call.timerID != 0 {
+		m.timerManager.DeleteTimer(call.timerID)
+	}
+	m.doRpcCallback(call.cb, replyMsg.Sender, replyMsg.Data, replyMsg.Err)
+}
+
 func (m *module) handleCustomAction(eventMsg EventMsg) {
 	customMsg := eventMsg.(CustomActionEventMsg)
 	action := customMsg.GetAction()
@@ -0,0 +1,279 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+type ActorID = uint64
+
+// ActorHandler handles a msg of an actor in the goroutine of its host module,
+// ActorOf returns the actor from the context. Replies are sent with
+// Context.Done as for an RpcHandler.
+type ActorHandler func(Context, *ArgsVar)
+
+var (
+	ErrActorExists   = errors.New("actor already exists")
+	ErrActorNotFound = errors.New("actor not found")
+	ErrActorStopped  = errors.New("actor stopped")
+)
+
+// ActorSpec is shared by the actors of a kind, e.g. all the players.
+type ActorSpec struct {
+	Handlers map[string]ActorHandler
+	OnStart  func(*Actor)
+	OnStop   func(*Actor)
+}
+
+// Actor is a lightweight entity hosted by a module, its msgs are handled one
+// by one in the host goroutine. An actor is stopped with Stop or when the
+// host module is removed, its timers are removed then.
+type Actor struct {
+	id      ActorID
+	host    *module
+	spec    *ActorSpec
+	attach  interface{}
+	timers  map[uint64]struct{}
+	stopped bool
+}
+
+type actorMsg struct {
+	actor   *Actor
+	sender  Agent
+	name    string
+	data    []interface{}
+	session uint64
+}
+
+func (e *actorMsg) GetType() EventType {
+	return event.EVENT_ACTOR_MSG
+}
+
+func (e *actorMsg) Reset() {
+	e.actor = nil
+	e.sender = nil
+	e.name = ""
+	e.data = nil
+	e.session = 0
+}
+
+var (
+	actor_map      sync.Map
+	actor_msg_pool = &sync.Pool{New: func() interface{} { return new(actorMsg) }}
+)
+
+// SpawnActor creates the actor [id] on the host module, OnStart is called in
+// the host goroutine before the msgs sent to the actor. The actor is hosted
+// once OnStart returns, when it panics the actor is dropped without OnStop.
+func SpawnActor(host Module, id ActorID, spec *ActorSpec, attach interface{}) (*Actor, error) {
+	m, ok := host.(*module)
+	if !ok {
+		return nil, fmt.Errorf("%w: actor [%d] unsupported host [%v]", ErrModuleNotFound, id, host)
+	}
+	if spec == nil {
+		spec = &ActorSpec{}
+	}
+	a := &Actor{
+		id:     id,
+		host:   m,
+		spec:   spec,
+		attach: attach,
+	}
+	if _, loaded := actor_map.LoadOrStore(id, a); loaded {
+		return nil, fmt.Errorf("%w: [%d]", ErrActorExists, id)
+	}
+	m.push(&moduleAction{f: func() {
+		if a.stopped {
+			return
+		}
+		if spec.OnStart != nil {
+			spec.OnStart(a)
+		}
+		if m.actorMap == nil {
+			m.actorMap = make(map[ActorID]*Actor)
+		}
+		m.actorMap[id] = a
+	}, drop: a.drop})
+	return a, nil
+}
+
+// SpawnPoolActor creates the actor [id] on the worker the pool routes its id
+// to.
+func SpawnPoolActor(pool WorkerPool, id ActorID, spec *ActorSpec, attach interface{}) (*Actor, error) {
+	return SpawnActor(pool.Route(id), id, spec, attach)
+}
+
+func FindActor(id ActorID) *Actor {
+	if v, ok := actor_map.Load(id); ok {
+		return v.(*Actor)
+	}
+	return nil
+}
+
+// ActorOf returns the actor whose msg the context handles.
+func ActorOf(ctx Context) *Actor {
+	a, _ := ctx.GetAttach().(*Actor)
+	return a
+}
+
+func SendActor(id ActorID, name string, args ...interface{}) error {
+	a := FindActor(id)
+	if a == nil {
+		return fmt.Errorf("%w: [%d]", ErrActorNotFound, id)
+	}
+	a.Send(name, args...)
+	return nil
+}
+
+func CallActor(caller Module, id ActorID, name string, timeout uint64, cb RpcCallback, args ...interface{}) error {
+	a := FindActor(id)
+	if a == nil {
+		return fmt.Errorf("%w: [%d]", ErrActorNotFound, id)
+	}
+	a.Call(caller, name, timeout, cb, args...)
+	return nil
+}
+
+func (a *Actor) GetID() ActorID {
+	return a.id
+}
+
+func (a *Actor) GetHost() Module {
+	return a.host
+}
+
+func (a *Actor) GetAttach() interface{} {
+	return a.attach
+}
+
+func (a *Actor) Send(name string, args ...interface{}) {
+	a.post(nil, name, args, 0)
+}
+
+// Call calls the handler [name] of the actor from the caller module, cb is
+// called in the caller goroutine with the reply.
+func (a *Actor) Call(caller Module, name string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	c, ok := caller.(rpcCaller)
+	if !ok {
+		slog.LogError("module", "actor [%d] call [%s] from unsupported caller [%v]", a.id, name, caller)
+		return
+	}
+	a.post(c, name, args, c.addRpcCall(cb, timeout))
+}
+
+func (a *Actor) post(sender Agent, name string, args []interface{}, session uint64) {
+	e := actor_msg_pool.Get().(*actorMsg)
+	e.actor = a
+	e.sender = sender
+	e.name = name
+	e.data = args
+	e.session = session
+	a.host.push(e)
+}
+
+// Stop stops the actor after the msgs already sent to it.
+func (a *Actor) Stop() {
+	a.host.push(&moduleAction{f: a.stop, drop: a.unregister})
+}
+
+// AddTimer adds a timer removed when the actor stops, it is called in the
+// host goroutine.
+func (a *Actor) AddTimer(delay uint64, op TimerHandler, args ...interface{}) uint64 {
+	if a.stopped {
+		return 0
+	}
+	var id uint64
+	id = a.host.AddTimer(delay, func(args []interface{}) {
+		delete(a.timers, id)
+		if !a.stopped {
+			op(args)
+		}
+	}, args...)
+	if a.timers == nil {
+		a.timers = make(map[uint64]struct{})
+	}
+	a.timers[id] = struct{}{}
+	return id
+}
+
+func (a *Actor) RemoveTimer(id uint64) bool {
+	if _, ok := a.timers[id]; !ok {
+		return false
+	}
+	delete(a.timers, id)
+	return a.host.RemoveTimer(id)
+}
+
+func (a *Actor) stop() {
+	if a.stopped {
+		return
+	}
+	a.drop()
+	if a.spec.OnStop != nil {
+		a.spec.OnStop(a)
+	}
+}
+
+// drop removes an actor that failed to start or whose host exited first.
+func (a *Actor) drop() {
+	a.stopped = true
+	for id := range a.timers {
+		a.host.RemoveTimer(id)
+	}
+	a.timers = nil
+	delete(a.host.actorMap, a.id)
+	a.unregister()
+}
+
+func (a *Actor) unregister() {
+	if v, ok := actor_map.Load(a.id); ok && v == a {
+		actor_map.Delete(a.id)
+	}
+}
+
+func (m *module) handleActorMsg(eventMsg EventMsg) {
+	e := eventMsg.(*actorMsg)
+	a := e.actor
+	handler, ok := a.spec.Handlers[e.name]
+	switch {
+	case a.stopped:
+		if e.session != 0 {
+			replyRpc(m, e.sender, e.session, nil, ErrActorStopped)
+		}
+	case !ok:
+		slog.LogError("module", "actor [%d] unregister handler [%s]", a.id, e.name)
+		if e.session != 0 {
+			replyRpc(m, e.sender, e.session, nil, ErrRpcNoHandler)
+		}
+	default:
+		args := &m.args
+		args.ref(e.data)
+		if e.session != 0 {
+			// the handler may keep the context and reply later
+			ctx := &ModuleContext{m: m, s: e.sender, t: a, q: e.session}
+			m.curCtx = ctx
+			handler(ctx, args)
+		} else {
+			ctx := m.context
+			ctx.s = e.sender
+			ctx.t = a
+			handler(ctx, args)
+			ctx.Reset()
+		}
+		args.clear()
+	}
+	e.Reset()
+	actor_msg_pool.Put(e)
+}
+
+// stopActors stops the actors hosted by the module when it closes.
+func (m *module) stopActors() {
+	for _, a := range m.actorMap {
+		a.stop()
+	}
+	m.actorMap = nil
+}
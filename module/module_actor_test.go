@@ -0,0 +1,208 @@
+package module
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inModule runs f in the goroutine of m and waits for it.
+func inModule(t *testing.T, m *module, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	m.push(&moduleAction{f: func() {
+		f()
+		close(done)
+	}})
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("module action not run")
+	}
+}
+
+// callActorFrom calls the handler [name] of a in the goroutine of caller.
+func callActorFrom(caller *module, a *Actor, name string, args ...interface{}) chan callReply {
+	c := make(chan callReply, 1)
+	caller.push(&moduleAction{f: func() {
+		a.Call(caller, name, 1000, func(ctx Context, r []interface{}, err error) {
+			c <- callReply{r, err}
+		}, args...)
+	}})
+	return c
+}
+
+func TestActorSerial(t *testing.T) {
+	caller := runTestModule(t, "test_actor_caller")
+	host := runTestModule(t, "test_actor_host")
+	var busy int32
+	var got []int
+	spec := &ActorSpec{Handlers: map[string]ActorHandler{
+		"add": func(ctx Context, args *ArgsVar) {
+			if !atomic.CompareAndSwapInt32(&busy, 0, 1) {
+				t.Errorf("actor msgs handled concurrently")
+			}
+			got = append(got, args.ReadInt(0))
+			atomic.StoreInt32(&busy, 0)
+		},
+		"count": func(ctx Context, args *ArgsVar) {
+			if ActorOf(ctx).GetAttach() != "player" {
+				t.Errorf("actor attach %v", ActorOf(ctx).GetAttach())
+			}
+			ctx.Done(len(got))
+		},
+	}}
+	a, err := SpawnActor(host, 101, spec, "player")
+	if err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	defer a.Stop()
+	if _, err := SpawnActor(host, 101, spec, nil); !errors.Is(err, ErrActorExists) {
+		t.Fatalf("spawn twice: %v", err)
+	}
+
+	const count = 100
+	for i := 0; i < count; i++ {
+		if err := SendActor(101, "add", i); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	r := waitReply(t, callActorFrom(caller, a, "count"))
+	if r.err != nil || len(r.reply) != 1 || r.reply[0] != count {
+		t.Fatalf("count reply %v %v", r.reply, r.err)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("msg %d handled as %d", i, v)
+		}
+	}
+	r = waitReply(t, callActorFrom(caller, a, "missing"))
+	if !errors.Is(r.err, ErrRpcNoHandler) {
+		t.Fatalf("missing handler reply %v %v", r.reply, r.err)
+	}
+}
+
+func TestActorStop(t *testing.T) {
+	caller := runTestModule(t, "test_actor_stop_caller")
+	host := runTestModule(t, "test_actor_stop_host")
+	fired := make(chan struct{}, 1)
+	var stops int32
+	spec := &ActorSpec{
+		Handlers: map[string]ActorHandler{
+			"ping": func(ctx Context, args *ArgsVar) { ctx.Done("pong") },
+		},
+		OnStart: func(a *Actor) {
+			a.AddTimer(50, func([]interface{}) { fired <- struct{}{} })
+		},
+		OnStop: func(a *Actor) { atomic.AddInt32(&stops, 1) },
+	}
+	a, err := SpawnActor(host, 102, spec, nil)
+	if err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	r := waitReply(t, callActorFrom(caller, a, "ping"))
+	if r.err != nil || r.reply[0] != "pong" {
+		t.Fatalf("ping reply %v %v", r.reply, r.err)
+	}
+	a.Stop()
+	a.Stop()
+
+	r = waitReply(t, callActorFrom(caller, a, "ping"))
+	if !errors.Is(r.err, ErrActorStopped) {
+		t.Fatalf("reply after stop %v %v", r.reply, r.err)
+	}
+	if FindActor(102) != nil || !errors.Is(SendActor(102, "ping"), ErrActorNotFound) {
+		t.Fatalf("stopped actor still registered")
+	}
+	inModule(t, host, func() {
+		if _, ok := host.actorMap[102]; ok {
+			t.Errorf("stopped actor still hosted")
+		}
+	})
+	if n := atomic.LoadInt32(&stops); n != 1 {
+		t.Fatalf("OnStop called %d times", n)
+	}
+	select {
+	case <-fired:
+		t.Fatal("actor timer fired after stop")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestActorStartPanic(t *testing.T) {
+	caller := runTestModule(t, "test_actor_panic_caller")
+	host := runTestModule(t, "test_actor_panic_host")
+	var stops int32
+	spec := &ActorSpec{
+		Handlers: map[string]ActorHandler{
+			"ping": func(ctx Context, args *ArgsVar) { ctx.Done("pong") },
+		},
+		OnStart: func(a *Actor) {
+			a.AddTimer(10000, func([]interface{}) {})
+			panic("boom")
+		},
+		OnStop: func(a *Actor) { atomic.AddInt32(&stops, 1) },
+	}
+	a, err := SpawnActor(host, 103, spec, nil)
+	if err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	r := waitReply(t, callActorFrom(caller, a, "ping"))
+	if !errors.Is(r.err, ErrActorStopped) {
+		t.Fatalf("reply after a failed start %v %v", r.reply, r.err)
+	}
+	if FindActor(103) != nil {
+		t.Fatalf("failed actor still registered")
+	}
+	inModule(t, host, func() {
+		if _, ok := host.actorMap[103]; ok {
+			t.Errorf("failed actor hosted")
+		}
+		if len(a.timers) != 0 {
+			t.Errorf("failed actor kept %d timers", len(a.timers))
+		}
+		host.stopActors()
+	})
+	if n := atomic.LoadInt32(&stops); n != 0 {
+		t.Fatalf("OnStop called %d times for an actor never started", n)
+	}
+}
+
+func TestActorHostRemoved(t *testing.T) {
+	resetModules(t)
+	host := GetModule("test_actor_removed").(*module)
+	if err := Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	spec := &ActorSpec{
+		OnStart: func(a *Actor) { close(started) },
+		OnStop:  func(a *Actor) { close(stopped) },
+	}
+	if _, err := SpawnActor(host, 104, spec, nil); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	<-started
+	if err := RemoveModule("test_actor_removed"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("actor not stopped with its host")
+	}
+	if FindActor(104) != nil {
+		t.Fatalf("actor of a removed host still registered")
+	}
+
+	// the actors spawned after the host exited are dropped
+	a, err := SpawnActor(host, 105, spec, nil)
+	if err != nil {
+		t.Fatalf("spawn on a removed host: %v", err)
+	}
+	if FindActor(105) != nil || !a.stopped {
+		t.Fatalf("actor of a removed host kept")
+	}
+}
@@ -0,0 +1,208 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+var (
+	ErrRpcArgs = errors.New("rpc arguments mismatch")
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterRpcFunc registers f, a func(Context, args...) with any results, as
+// the rpc handler [name]. The arguments are converted to the parameter types,
+// numbers are widened and strings, e.g. from the console, are parsed. A call
+// whose arguments do not fit is answered with ErrRpcArgs. When f has results
+// they are the reply, a trailing error result is the reply error, otherwise
+// f replies with Context.Done as an RpcHandler does.
+func RegisterRpcFunc(r ModuleRouter, name string, f interface{}) {
+	v := reflect.ValueOf(f)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() < 1 || t.In(0) != contextType {
+		panic("rpc func must be a func(Context, ...)")
+	}
+	withErr := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	r.RegisterRpcHandler(name, func(ctx Context, args *ArgsVar) {
+		in, err := convertArgs(t, args.args)
+		if err != nil {
+			err = fmt.Errorf("%w: rpc [%s] %v", ErrRpcArgs, name, err)
+			slog.LogWarning("module", "%v", err)
+			replyFunc(ctx, nil, err)
+			return
+		}
+		in[0] = reflect.ValueOf(&ctx).Elem()
+		out := v.Call(in)
+		if len(out) == 0 {
+			return
+		}
+		if withErr {
+			if e := out[len(out)-1].Interface(); e != nil {
+				err = e.(error)
+			}
+			out = out[:len(out)-1]
+		}
+		var reply []interface{}
+		for _, o := range out {
+			reply = append(reply, o.Interface())
+		}
+		replyFunc(ctx, reply, err)
+	})
+}
+
+// replyFunc answers the caller, AwaitRpcCall gets the error after the results.
+func replyFunc(ctx Context, reply []interface{}, err error) {
+	c, ok := ctx.(*ModuleContext)
+	if !ok {
+		return
+	}
+	if c.u != nil && err != nil {
+		reply = append(reply, err)
+	}
+	c.reply(reply, err)
+}
+
+func convertArgs(t reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	fixed := t.NumIn() - 1
+	if t.IsVariadic() {
+		fixed--
+	}
+	if len(args) < fixed || (!t.IsVariadic() && len(args) > fixed) {
+		return nil, fmt.Errorf("wants %d args got %d", fixed, len(args))
+	}
+	in := make([]reflect.Value, 1, len(args)+1)
+	for i, arg := range args {
+		var pt reflect.Type
+		if i < fixed {
+			pt = t.In(i + 1)
+		} else {
+			pt = t.In(t.NumIn() - 1).Elem()
+		}
+		v, ok := convertArg(arg, pt)
+		if !ok {
+			return nil, fmt.Errorf("arg %d wants %v got %T", i, pt, arg)
+		}
+		in = append(in, v)
+	}
+	return in, nil
+}
+
+// convertArg converts an rpc argument to t, it fails on a loss of value.
+func convertArg(arg interface{}, t reflect.Type) (reflect.Value, bool) {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), true
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	a := reflect.ValueOf(arg)
+	if a.Type() == t || (t.Kind() == reflect.Interface && a.Type().Implements(t)) {
+		return a.Convert(t), true
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, ok := argInt(a)
+		if !ok || v.OverflowInt(x) {
+			return v, false
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, ok := argUint(a)
+		if !ok || v.OverflowUint(x) {
+			return v, false
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		x, ok := argFloat(a)
+		if !ok || v.OverflowFloat(x) {
+			return v, false
+		}
+		v.SetFloat(x)
+	case reflect.Bool:
+		s, ok := arg.(string)
+		if !ok {
+			return v, false
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, false
+		}
+		v.SetBool(b)
+	case reflect.String:
+		switch a.Kind() {
+		case reflect.String:
+			v.SetString(a.String())
+		case reflect.Slice:
+			if a.Type().Elem().Kind() != reflect.Uint8 {
+				return v, false
+			}
+			v.SetString(string(a.Bytes()))
+		default:
+			return v, false
+		}
+	default:
+		if network.RpcAssign(v, arg) != nil {
+			return v, false
+		}
+	}
+	return v, true
+}
+
+func argInt(a reflect.Value) (int64, bool) {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x := a.Uint()
+		return int64(x), x <= math.MaxInt64
+	case reflect.Float32, reflect.Float64:
+		f := a.Float()
+		return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	case reflect.String:
+		x, err := strconv.ParseInt(a.String(), 0, 64)
+		return x, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func argUint(a reflect.Value) (uint64, bool) {
+	switch a.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint(), true
+	case reflect.String:
+		x, err := strconv.ParseUint(a.String(), 0, 64)
+		return x, err == nil
+	default:
+		x, ok := argInt(a)
+		return uint64(x), ok && x >= 0
+	}
+}
+
+func argFloat(a reflect.Value) (float64, bool) {
+	switch a.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return a.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(a.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(a.Uint()), true
+	case reflect.String:
+		x, err := strconv.ParseFloat(a.String(), 64)
+		return x, err == nil
+	default:
+		return 0, false
+	}
+}
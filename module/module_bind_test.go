@@ -0,0 +1,180 @@
+package module
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestConvertArg(t *testing.T) {
+	for _, d := range []struct {
+		arg  interface{}
+		to   interface{}
+		want interface{} // nil when the conversion fails
+	}{
+		// widening
+		{int8(-3), int64(0), int64(-3)},
+		{uint16(60000), int(0), 60000},
+		{int32(7), uint64(0), uint64(7)},
+		{3, float64(0), float64(3)},
+		{float32(1.5), float64(0), 1.5},
+		{[]byte("raw"), "", "raw"},
+		// the console sends strings
+		{"42", int(0), 42},
+		{"0x10", int32(0), int32(16)},
+		{"7", uint8(0), uint8(7)},
+		{"2.5", float64(0), 2.5},
+		{"true", false, true},
+		// a loss of value is refused
+		{300, int8(0), nil},
+		{-1, uint(0), nil},
+		{uint64(math.MaxUint64), int64(0), nil},
+		{1e40, float32(0), nil},
+		{1.5, int(0), nil},
+		{float64(math.MaxInt64) * 2, int64(0), nil},
+		{4.0, int(0), 4},
+		{"x", int(0), nil},
+		{"1", false, true},
+		{1, false, nil},
+		{1, "", nil},
+		{nil, int(0), nil},
+	} {
+		v, ok := convertArg(d.arg, reflect.TypeOf(d.to))
+		if d.want == nil {
+			if ok {
+				t.Errorf("%T %v to %T converted to %v", d.arg, d.arg, d.to, v)
+			}
+			continue
+		}
+		if !ok || v.Interface() != d.want {
+			t.Errorf("%T %v to %T: %v %v, want %v", d.arg, d.arg, d.to, v, ok, d.want)
+		}
+	}
+
+	if v, ok := convertArg(nil, reflect.TypeOf([]int(nil))); !ok || !v.IsNil() {
+		t.Errorf("nil to a slice: %v %v", v, ok)
+	}
+	if v, ok := convertArg([]interface{}{1, int8(2)}, reflect.TypeOf([]int(nil))); !ok || !reflect.DeepEqual(v.Interface(), []int{1, 2}) {
+		t.Errorf("list to []int: %v %v", v, ok)
+	}
+}
+
+func TestConvertArgs(t *testing.T) {
+	f := reflect.TypeOf(func(Context, string, ...int) {})
+	in, err := convertArgs(f, []interface{}{"sum", int8(1), "2", uint32(3)})
+	if err != nil || len(in) != 5 {
+		t.Fatalf("variadic args: %v %v", in, err)
+	}
+	for i, want := range []interface{}{"sum", 1, 2, 3} {
+		if in[i+1].Interface() != want {
+			t.Fatalf("arg %d is %v, want %v", i, in[i+1], want)
+		}
+	}
+	if in, err = convertArgs(f, []interface{}{"none"}); err != nil || len(in) != 2 {
+		t.Fatalf("no variadic args: %v %v", in, err)
+	}
+	if _, err = convertArgs(f, nil); err == nil {
+		t.Fatalf("missing fixed arg converted")
+	}
+	if _, err = convertArgs(f, []interface{}{"sum", 1.5}); err == nil {
+		t.Fatalf("truncated variadic arg converted")
+	}
+
+	g := reflect.TypeOf(func(Context, int) {})
+	if _, err = convertArgs(g, []interface{}{1, 2}); err == nil {
+		t.Fatalf("extra arg converted")
+	}
+}
+
+func TestRegisterRpcFunc(t *testing.T) {
+	caller := runTestModule(t, "test_bind_caller")
+	m := runTestModule(t, "test_bind")
+	errOdd := errors.New("odd")
+	RegisterRpcFunc(m, "half", func(ctx Context, x int64) (int64, error) {
+		if x%2 != 0 {
+			return 0, errOdd
+		}
+		return x / 2, nil
+	})
+	RegisterRpcFunc(m, "sum", func(ctx Context, xs ...uint8) int {
+		n := 0
+		for _, x := range xs {
+			n += int(x)
+		}
+		return n
+	})
+	RegisterRpcFunc(m, "done", func(ctx Context, s string) {
+		ctx.Done(s + "!")
+	})
+
+	if r := m.AwaitRpcCall("half", "8"); len(r) != 1 || r[0] != int64(4) {
+		t.Fatalf("half of a console string %v", r)
+	}
+	if r := m.AwaitRpcCall("half", int32(3)); len(r) != 2 || r[1] != errOdd {
+		t.Fatalf("half error %v", r)
+	}
+	if r := m.AwaitRpcCall("sum", 1, uint16(2), "3"); len(r) != 1 || r[0] != 6 {
+		t.Fatalf("variadic sum %v", r)
+	}
+	if r := m.AwaitRpcCall("done", []byte("hi")); len(r) != 1 || r[0] != "hi!" {
+		t.Fatalf("done reply %v", r)
+	}
+
+	for _, args := range [][]interface{}{{2.5}, {"x"}, {1, 2}, {}} {
+		r := m.AwaitRpcCall("half", args...)
+		if err, _ := r[len(r)-1].(error); !errors.Is(err, ErrRpcArgs) {
+			t.Fatalf("half %v: await reply %v, want ErrRpcArgs", args, r)
+		}
+	}
+	if r := m.AwaitRpcCall("sum", 1, 256); !errors.Is(r[len(r)-1].(error), ErrRpcArgs) {
+		t.Fatalf("sum overflow: await reply %v", r)
+	}
+	c := waitReply(t, callFrom(caller, m, "half", 1000, 1.5))
+	if !errors.Is(c.err, ErrRpcArgs) || len(c.reply) != 0 {
+		t.Fatalf("half 1.5: call reply %v %v, want ErrRpcArgs", c.reply, c.err)
+	}
+	c = waitReply(t, callFrom(caller, m, "half", 1000, 10))
+	if c.err != nil || len(c.reply) != 1 || c.reply[0] != int64(5) {
+		t.Fatalf("half 10: call reply %v %v", c.reply, c.err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("registered a func without a context")
+		}
+	}()
+	RegisterRpcFunc(m, "bad", func(int) {})
+}
+
+func TestArgsVarRead(t *testing.T) {
+	args := &ArgsVar{}
+	args.ref([]interface{}{"name", "12", int8(-3), 2.0, 2.5, nil})
+	if v := args.ReadInt(0); v != 0 {
+		t.Fatalf("ReadInt of a word %d", v)
+	}
+	if v := args.ReadInt(1); v != 12 {
+		t.Fatalf("ReadInt of a number string %d", v)
+	}
+	if v := args.ReadInt64(2); v != -3 {
+		t.Fatalf("ReadInt64 of an int8 %d", v)
+	}
+	if v := args.ReadUInt64(2); v != 0 {
+		t.Fatalf("ReadUInt64 of a negative %d", v)
+	}
+	if v := args.ReadInt32(3); v != 2 {
+		t.Fatalf("ReadInt32 of 2.0 %d", v)
+	}
+	if v := args.ReadInt(4); v != 0 {
+		t.Fatalf("ReadInt of 2.5 %d", v)
+	}
+	if v := args.ReadDouble(1); v != 12 {
+		t.Fatalf("ReadDouble of a number string %v", v)
+	}
+	if v := args.ReadString(5); v != "" {
+		t.Fatalf("ReadString of nil %q", v)
+	}
+	if v := args.ReadBool(9); v {
+		t.Fatalf("ReadBool out of range")
+	}
+}
@@ -0,0 +1,76 @@
+package module
+
+import (
+	"reflect"
+
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+// CodecHandler is a SessionHandler decoding the msgs registered with
+// network.RegisterMsg in the network goroutine and routing them to a module.
+// Session managers embed it to serve their linkers.
+type CodecHandler struct {
+	router ModuleRouter
+}
+
+func NewCodecHandler(router ModuleRouter) *CodecHandler {
+	return &CodecHandler{router: router}
+}
+
+func (h *CodecHandler) ServeHandler(a Agent, msgID ProtoTypeID, b []byte) {
+	msg, err := network.DecodeMsg(msgID, b)
+	if err != nil {
+		slog.LogWarning("codec", "agent [%v] decode msg [%v] error: %v", a.GetID(), msgID, err)
+		return
+	}
+	h.router.RouterMsg(a, msgID, msg)
+}
+
+// ServeRpc decodes an rpc packet, a RpcCodec list of the rpc name followed by
+// its arguments, and routes it with RouterRpc.
+func (h *CodecHandler) ServeRpc(a Agent, msgID ProtoTypeID, b []byte) {
+	var args []interface{}
+	if err := network.RpcCodec.Unmarshal(b, &args); err != nil {
+		slog.LogWarning("codec", "agent [%v] decode rpc [%v] error: %v", a.GetID(), msgID, err)
+		return
+	}
+	name, ok := rpcName(args)
+	if !ok {
+		slog.LogWarning("codec", "agent [%v] rpc [%v] has no name", a.GetID(), msgID)
+		return
+	}
+	h.router.RouterRpc(a, name, args[1:])
+}
+
+func rpcName(args []interface{}) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	name, ok := args[0].(string)
+	return name, ok && name != ""
+}
+
+var contextType = reflect.TypeOf((*Context)(nil)).Elem()
+
+// RegisterTypedHandler registers f, a func(Context, *T) where *T is a msg
+// registered with network.RegisterMsg, as the handler of the id of *T.
+func RegisterTypedHandler(r ModuleRouter, f interface{}) {
+	v := reflect.ValueOf(f)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 0 || t.In(0) != contextType {
+		panic("typed handler must be a func(Context, *T)")
+	}
+	msgID, ok := network.MsgTypeID(reflect.Zero(t.In(1)).Interface())
+	if !ok {
+		panic("typed handler msg type not registered")
+	}
+	r.RegisterHandler(msgID, func(ctx Context, msg interface{}) {
+		m := reflect.ValueOf(msg)
+		if m.Type() != t.In(1) {
+			slog.LogError("codec", "typed handler [%v] got msg [%T]", t, msg)
+			return
+		}
+		v.Call([]reflect.Value{reflect.ValueOf(&ctx).Elem(), m})
+	})
+}
@@ -0,0 +1,92 @@
+package module
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jslyzt/einx/network"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testCodecMsg ProtoTypeID = 9001
+
+var registerCodecMsg sync.Once
+
+type testAgent struct {
+	id AgentID
+}
+
+func (a *testAgent) GetID() AgentID { return a.id }
+func (a *testAgent) Close()         {}
+
+func TestCodecHandler(t *testing.T) {
+	registerCodecMsg.Do(func() {
+		network.RegisterMsg(testCodecMsg, (*wrapperspb.StringValue)(nil), network.ProtoCodec)
+	})
+	m := runTestModule(t, "test_codec")
+	msgs := make(chan string, 1)
+	RegisterTypedHandler(m, func(ctx Context, msg *wrapperspb.StringValue) {
+		msgs <- msg.Value
+	})
+	rpcs := make(chan []interface{}, 1)
+	m.RegisterRpcHandler("login", func(ctx Context, args *ArgsVar) {
+		rpcs <- []interface{}{ctx.GetSender().GetID(), args.ReadString(0), args.ReadInt(1)}
+	})
+
+	h := NewCodecHandler(m)
+	a := &testAgent{id: 7}
+	_, b, err := network.EncodeMsg(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	h.ServeHandler(a, testCodecMsg, b)
+	select {
+	case v := <-msgs:
+		if v != "hello" {
+			t.Fatalf("typed handler got %q", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("typed handler not called")
+	}
+
+	// the broken rpc packets are dropped, the next one is served
+	h.ServeRpc(a, 1, []byte{0xff})
+	nameless, _ := network.RpcCodec.Marshal(&[]interface{}{1, "x"})
+	h.ServeRpc(a, 1, nameless)
+	b, err = network.RpcCodec.Marshal(&[]interface{}{"login", "einx", 3})
+	if err != nil {
+		t.Fatalf("encode rpc: %v", err)
+	}
+	h.ServeRpc(a, 1, b)
+	select {
+	case r := <-rpcs:
+		if r[0] != AgentID(7) || r[1] != "einx" || r[2] != 3 {
+			t.Fatalf("rpc got %v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rpc not routed")
+	}
+}
+
+func TestRegisterTypedHandlerPanics(t *testing.T) {
+	m := NewModule("test_typed_panics")
+	for _, d := range []struct {
+		name string
+		f    interface{}
+	}{
+		{"not a func", 1},
+		{"no context", func(int, *wrapperspb.StringValue) {}},
+		{"results", func(Context, *wrapperspb.StringValue) error { return nil }},
+		{"unregistered", func(Context, *wrapperspb.BoolValue) {}},
+	} {
+		t.Run(d.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("registered without a panic")
+				}
+			}()
+			RegisterTypedHandler(m.(ModuleRouter), d.f)
+		})
+	}
+}
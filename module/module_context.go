@@ -1,5 +1,9 @@
 package module
 
+import (
+	"reflect"
+)
+
 type ModuleContext struct {
 	m Module
 	s Agent
@@ -7,6 +11,7 @@ type ModuleContext struct {
 	t interface{}
 	v map[int]interface{}
 	u chan []interface{}
+	q uint64
 }
 
 func (c *ModuleContext) Reset() {
@@ -14,6 +19,7 @@ func (c *ModuleContext) Reset() {
 	c.c = nil
 	c.t = nil
 	c.u = nil
+	c.q = 0
 }
 
 func (c *ModuleContext) GetModule() Module {
@@ -48,12 +54,25 @@ func (c *ModuleContext) Get(k int) interface{} {
 }
 
 func (c *ModuleContext) Done(args ...interface{}) {
-	if c.u == nil {
+	c.reply(args, nil)
+}
+
+func (c *ModuleContext) reply(args []interface{}, err error) {
+	if c.u != nil {
+		u := c.u
+		c.u = nil
+		u <- args
 		return
 	}
-	c.u <- args
+	if c.q != 0 {
+		q := c.q
+		c.q = 0
+		replyRpc(c.m.(Agent), c.s, q, args, err)
+	}
 }
 
+// ArgsVar holds the arguments of an RpcHandler, the readers convert them like
+// RegisterRpcFunc does and return the zero value when they do not fit.
 type ArgsVar struct {
 	args []interface{}
 }
@@ -82,49 +101,56 @@ func (s *ArgsVar) ReadBool(i int) bool {
 	if len(s.args) <= i {
 		return false
 	}
-	return s.args[i].(bool)
+	v, _ := s.convert(i, boolType).(bool)
+	return v
 }
 
 func (s *ArgsVar) ReadInt(i int) int {
 	if len(s.args) <= i {
 		return 0
 	}
-	return s.args[i].(int)
+	v, _ := s.convert(i, intType).(int)
+	return v
 }
 
 func (s *ArgsVar) ReadInt32(i int) int32 {
 	if len(s.args) <= i {
 		return 0
 	}
-	return s.args[i].(int32)
+	v, _ := s.convert(i, int32Type).(int32)
+	return v
 }
 
 func (s *ArgsVar) ReadInt64(i int) int64 {
 	if len(s.args) <= i {
 		return 0
 	}
-	return s.args[i].(int64)
+	v, _ := s.convert(i, int64Type).(int64)
+	return v
 }
 
 func (s *ArgsVar) ReadUInt64(i int) uint64 {
 	if len(s.args) <= i {
 		return 0
 	}
-	return s.args[i].(uint64)
+	v, _ := s.convert(i, uint64Type).(uint64)
+	return v
 }
 
 func (s *ArgsVar) ReadDouble(i int) float64 {
 	if len(s.args) <= i {
 		return 0
 	}
-	return s.args[i].(float64)
+	v, _ := s.convert(i, float64Type).(float64)
+	return v
 }
 
 func (s *ArgsVar) ReadString(i int) string {
 	if len(s.args) <= i {
 		return ""
 	}
-	return s.args[i].(string)
+	v, _ := s.convert(i, stringType).(string)
+	return v
 }
 
 func (s *ArgsVar) Read(i int) interface{} {
@@ -133,3 +159,21 @@ func (s *ArgsVar) Read(i int) interface{} {
 	}
 	return s.args[i]
 }
+
+var (
+	boolType    = reflect.TypeOf(false)
+	intType     = reflect.TypeOf(int(0))
+	int32Type   = reflect.TypeOf(int32(0))
+	int64Type   = reflect.TypeOf(int64(0))
+	uint64Type  = reflect.TypeOf(uint64(0))
+	float64Type = reflect.TypeOf(float64(0))
+	stringType  = reflect.TypeOf("")
+)
+
+func (s *ArgsVar) convert(i int, t reflect.Type) interface{} {
+	v, ok := convertArg(s.args[i], t)
+	if !ok {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,162 @@
+package module
+
+import (
+	"github.com/jslyzt/einx/network"
+)
+
+type NetLinker = network.NetLinker
+
+// GroupMgr is implemented by modules to keep named groups of their linkers.
+type GroupMgr interface {
+	CreateGroup(string) *SessionGroup
+	GetGroup(string) *SessionGroup
+	DeleteGroup(string)
+}
+
+// SessionGroup is a set of linkers owned by a module, e.g. a room, a guild or
+// an aoi cell. It must only be used by the module goroutine. Members are the
+// linkers of the module components, they leave every group when closed.
+type SessionGroup struct {
+	name    string
+	owner   *module
+	members map[AgentID]NetLinker
+	linkers []NetLinker
+}
+
+func (g *SessionGroup) Name() string {
+	return g.name
+}
+
+func (g *SessionGroup) Count() int {
+	return len(g.members)
+}
+
+func (g *SessionGroup) Has(id AgentID) bool {
+	_, ok := g.members[id]
+	return ok
+}
+
+// Join returns false when a is not a linker of the module or already joined.
+func (g *SessionGroup) Join(a Agent) bool {
+	l, ok := a.(NetLinker)
+	if !ok || g.owner == nil {
+		return false
+	}
+	id := a.GetID()
+	if _, ok := g.owner.agentMap[id]; !ok {
+		return false
+	}
+	if _, ok := g.members[id]; ok {
+		return false
+	}
+	g.members[id] = l
+	g.owner.agentGroups[id] = append(g.owner.agentGroups[id], g)
+	return true
+}
+
+func (g *SessionGroup) Leave(id AgentID) bool {
+	if _, ok := g.members[id]; !ok {
+		return false
+	}
+	delete(g.members, id)
+	if g.owner != nil {
+		g.owner.unlinkGroup(id, g)
+	}
+	return true
+}
+
+// Range stops when f returns false.
+func (g *SessionGroup) Range(f func(AgentID, NetLinker) bool) {
+	for id, l := range g.members {
+		if !f(id, l) {
+			return
+		}
+	}
+}
+
+// Broadcast queues the msg to every member, b is framed once and must not be
+// modified afterwards. It returns the number of members the msg was queued to.
+func (g *SessionGroup) Broadcast(msgID ProtoTypeID, b []byte) int {
+	return g.BroadcastExcept(msgID, b)
+}
+
+// BroadcastExcept is Broadcast skipping the members in exclude.
+func (g *SessionGroup) BroadcastExcept(msgID ProtoTypeID, b []byte, exclude ...AgentID) int {
+	linkers := g.linkers[:0]
+	for id, l := range g.members {
+		if !excluded(id, exclude) {
+			linkers = append(linkers, l)
+		}
+	}
+	count := network.Broadcast(linkers, msgID, b)
+	for i := range linkers {
+		linkers[i] = nil
+	}
+	g.linkers = linkers
+	return count
+}
+
+func excluded(id AgentID, exclude []AgentID) bool {
+	for _, v := range exclude {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateGroup returns the group [name], it is created when missing.
+func (m *module) CreateGroup(name string) *SessionGroup {
+	if g, ok := m.groupMap[name]; ok {
+		return g
+	}
+	g := &SessionGroup{
+		name:    name,
+		owner:   m,
+		members: make(map[AgentID]NetLinker),
+	}
+	m.groupMap[name] = g
+	return g
+}
+
+func (m *module) GetGroup(name string) *SessionGroup {
+	return m.groupMap[name]
+}
+
+// DeleteGroup removes every member from the group [name] and forgets it.
+func (m *module) DeleteGroup(name string) {
+	g, ok := m.groupMap[name]
+	if !ok {
+		return
+	}
+	delete(m.groupMap, name)
+	for id := range g.members {
+		m.unlinkGroup(id, g)
+	}
+	g.members = make(map[AgentID]NetLinker)
+	g.owner = nil
+}
+
+func (m *module) unlinkGroup(id AgentID, g *SessionGroup) {
+	groups := m.agentGroups[id]
+	for i, v := range groups {
+		if v == g {
+			groups[i] = groups[len(groups)-1]
+			groups[len(groups)-1] = nil
+			groups = groups[:len(groups)-1]
+			break
+		}
+	}
+	if len(groups) == 0 {
+		delete(m.agentGroups, id)
+	} else {
+		m.agentGroups[id] = groups
+	}
+}
+
+func (m *module) leaveGroups(id AgentID) {
+	for _, g := range m.agentGroups[id] {
+		delete(g.members, id)
+	}
+	delete(m.agentGroups, id)
+}
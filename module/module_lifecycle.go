@@ -0,0 +1,312 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+const (
+	MODULE_START_TIMEOUT = 10000 //Millisecond
+	MODULE_STOP_TIMEOUT  = 10000 //Millisecond
+)
+
+var (
+	ErrModuleCycle      = errors.New("module dependency cycle")
+	ErrModuleDependency = errors.New("module dependency not found")
+	ErrModuleTimeout    = errors.New("module lifecycle timeout")
+	ErrModuleHook       = errors.New("module lifecycle hook failed")
+)
+
+// Lifecycle declares how a module or a worker pool is started and stopped.
+// OnInit is called for every module before any is started, OnStart and OnStop
+// run in the module goroutine, in each worker of a pool. A module is ready
+// once OnStart returned, its dependents are started after that.
+type Lifecycle struct {
+	DependsOn    []string // modules or worker pools started before and stopped after it
+	OnInit       func(Module) error
+	OnStart      func(Context) error
+	OnStop       func(Context)
+	StartTimeout int64 //Millisecond, MODULE_START_TIMEOUT by default
+	StopTimeout  int64 //Millisecond, MODULE_STOP_TIMEOUT by default
+}
+
+type lifecycleUnit struct {
+	name    string
+	modules []*module
+	cycle   Lifecycle
+}
+
+var (
+	lifecycle_lock  sync.Mutex
+	lifecycle_map   = make(map[string]Lifecycle)
+	started_units   []*lifecycleUnit
+	modules_running bool
+	runtime_lock    sync.Mutex // serializes Close and the runtime start and removal
+)
+
+// SetLifecycle declares the lifecycle of the module or worker pool [name], it
+// must be called before Start.
+func SetLifecycle(name string, l Lifecycle) {
+	lifecycle_lock.Lock()
+	lifecycle_map[name] = l
+	lifecycle_lock.Unlock()
+}
+
+func collectUnits() map[string]*lifecycleUnit {
+	units := make(map[string]*lifecycleUnit)
+	module_map.Range(func(k interface{}, m interface{}) bool {
+		units[k.(string)] = newUnit(k.(string), m)
+		return true
+	})
+	worker_pools_map.Range(func(k interface{}, v interface{}) bool {
+		units[k.(string)] = newUnit(k.(string), v)
+		return true
+	})
+	return units
+}
+
+func newUnit(name string, v interface{}) *lifecycleUnit {
+	u := &lifecycleUnit{name: name}
+	switch v := v.(type) {
+	case *module:
+		u.modules = []*module{v}
+	case *ModuleWorkerPool:
+		for _, m := range v.modules {
+			u.modules = append(u.modules, m.(*module))
+		}
+	}
+	return u
+}
+
+// sortUnits orders the units so that every unit follows its dependencies,
+// the units are visited by name to keep the order stable.
+func sortUnits(units map[string]*lifecycleUnit) ([]*lifecycleUnit, error) {
+	lifecycle_lock.Lock()
+	for name, l := range lifecycle_map {
+		u, ok := units[name]
+		if !ok {
+			lifecycle_lock.Unlock()
+			return nil, fmt.Errorf("%w: lifecycle of [%s] declared but no such module", ErrModuleDependency, name)
+		}
+		u.cycle = l
+	}
+	lifecycle_lock.Unlock()
+
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	order := make([]*lifecycleUnit, 0, len(units))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s -> %s", ErrModuleCycle, strings.Join(path, " -> "), name)
+		}
+		u := units[name]
+		state[name] = visiting
+		path = append(path, name)
+		deps := append([]string(nil), u.cycle.DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, ok := units[dep]; !ok {
+				return fmt.Errorf("%w: [%s] depends on [%s]", ErrModuleDependency, name, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, u)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// moduleAction runs f in the module goroutine.
+type moduleAction struct {
+	f    func()
+	drop func() // called instead of f when the module exited
+}
+
+func (a *moduleAction) GetType() EventType {
+	return event.EVENT_COMPONENT_CUSTOM
+}
+
+func (a *moduleAction) GetSender() Agent {
+	return nil
+}
+
+func (a *moduleAction) GetAction() func(CustomActionEventMsg) {
+	return func(CustomActionEventMsg) { a.f() }
+}
+
+func (a *moduleAction) Reset() {
+}
+
+// call runs f in every module of the unit and waits for them.
+func (u *lifecycleUnit) call(f func(Context) error, timeout int64, def int64) error {
+	if timeout <= 0 {
+		timeout = def
+	}
+	results := make(chan error, len(u.modules))
+	for _, m := range u.modules {
+		m := m
+		m.PushEventMsg(&moduleAction{f: func() {
+			ctx := m.context
+			defer func() {
+				ctx.Reset()
+				if r := recover(); r != nil {
+					results <- fmt.Errorf("%w: [%s] panic %v", ErrModuleHook, m.name, r)
+				}
+			}()
+			err := f(ctx)
+			if err != nil {
+				err = fmt.Errorf("%w: [%s] %v", ErrModuleHook, m.name, err)
+			}
+			results <- err
+		}, drop: func() {
+			results <- fmt.Errorf("%w: [%s]", ErrModuleClosed, m.name)
+		}})
+	}
+
+	deadline := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+	defer deadline.Stop()
+	for range u.modules {
+		select {
+		case err := <-results:
+			if err != nil {
+				return err
+			}
+		case <-deadline.C:
+			return fmt.Errorf("%w: [%s] after %dms", ErrModuleTimeout, u.name, timeout)
+		}
+	}
+	return nil
+}
+
+func (u *lifecycleUnit) init() error {
+	if u.cycle.OnInit == nil {
+		return nil
+	}
+	for _, m := range u.modules {
+		if err := u.cycle.OnInit(m); err != nil {
+			return fmt.Errorf("%w: [%s] init %v", ErrModuleHook, u.name, err)
+		}
+	}
+	return nil
+}
+
+func (u *lifecycleUnit) start() error {
+	for _, m := range u.modules {
+		wait_close.Add(1)
+		go m.Run(&wait_close)
+	}
+	if u.cycle.OnStart == nil {
+		return nil
+	}
+	return u.call(u.cycle.OnStart, u.cycle.StartTimeout, MODULE_START_TIMEOUT)
+}
+
+// stop returns false when the unit did not stop in time.
+func (u *lifecycleUnit) stop() bool {
+	timeout := u.cycle.StopTimeout
+	if timeout <= 0 {
+		timeout = MODULE_STOP_TIMEOUT
+	}
+	if onStop := u.cycle.OnStop; onStop != nil {
+		err := u.call(func(ctx Context) error { onStop(ctx); return nil }, timeout, timeout)
+		if err != nil {
+			slog.LogError("module", "module [%s] stop: %v", u.name, err)
+		}
+	}
+
+	deadline := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+	defer deadline.Stop()
+	for _, m := range u.modules {
+		go m.Close()
+	}
+	for _, m := range u.modules {
+		select {
+		case <-m.exitChan:
+		case <-deadline.C:
+			slog.LogError("module", "module [%s] stop: %v after %dms", u.name, ErrModuleTimeout, timeout)
+			return false
+		}
+	}
+	return true
+}
+
+// Start runs the modules and worker pools in the order of their dependencies,
+// each one once the previous are ready. On error the started ones are stopped.
+func Start() error {
+	order, err := sortUnits(collectUnits())
+	if err != nil {
+		return err
+	}
+	for _, u := range order {
+		if err := u.init(); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range order {
+		lifecycle_lock.Lock()
+		started_units = append(started_units, u)
+		lifecycle_lock.Unlock()
+		if err := u.start(); err != nil {
+			Close()
+			return err
+		}
+		slog.LogInfo("module", "module [%s] started", u.name)
+	}
+	lifecycle_lock.Lock()
+	modules_running = true
+	lifecycle_lock.Unlock()
+	return nil
+}
+
+// Close stops the started modules and worker pools in the reverse order.
+func Close() {
+	runtime_lock.Lock()
+	defer runtime_lock.Unlock()
+	lifecycle_lock.Lock()
+	units := started_units
+	started_units = nil
+	modules_running = false
+	lifecycle_lock.Unlock()
+
+	stopped := true
+	for i := len(units) - 1; i >= 0; i-- {
+		if !units[i].stop() {
+			stopped = false
+		}
+	}
+	if stopped {
+		wait_close.Wait()
+	}
+}
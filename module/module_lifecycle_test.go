@@ -0,0 +1,151 @@
+package module
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetModules clears the registered modules around a test of Start.
+func resetModules(t *testing.T) {
+	clear := func() {
+		Close()
+		module_map.Range(func(k interface{}, v interface{}) bool {
+			module_map.Delete(k)
+			return true
+		})
+		worker_pools_map.Range(func(k interface{}, v interface{}) bool {
+			worker_pools_map.Delete(k)
+			return true
+		})
+		lifecycle_lock.Lock()
+		lifecycle_map = make(map[string]Lifecycle)
+		lifecycle_lock.Unlock()
+	}
+	clear()
+	t.Cleanup(clear)
+}
+
+type hookLog struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (l *hookLog) add(s string) {
+	l.lock.Lock()
+	l.calls = append(l.calls, s)
+	l.lock.Unlock()
+}
+
+func (l *hookLog) take() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	s := strings.Join(l.calls, " ")
+	l.calls = nil
+	return s
+}
+
+func (l *hookLog) lifecycle(name string, deps ...string) Lifecycle {
+	return Lifecycle{
+		DependsOn: deps,
+		OnStart: func(Context) error {
+			l.add("start:" + name)
+			return nil
+		},
+		OnStop: func(Context) {
+			l.add("stop:" + name)
+		},
+	}
+}
+
+func TestStartOrder(t *testing.T) {
+	resetModules(t)
+	log := &hookLog{}
+	GetModule("test_gate")
+	CreateWorkers("test_game", 2)
+	GetModule("test_db")
+	GetModule("test_log")
+	SetLifecycle("test_gate", log.lifecycle("test_gate", "test_game"))
+	SetLifecycle("test_game", log.lifecycle("test_game", "test_db", "test_log"))
+	SetLifecycle("test_db", log.lifecycle("test_db", "test_log"))
+	SetLifecycle("test_log", log.lifecycle("test_log"))
+
+	if err := Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	want := "start:test_log start:test_db start:test_game start:test_game start:test_gate"
+	if got := log.take(); got != want {
+		t.Fatalf("start order %q, want %q", got, want)
+	}
+	Close()
+	want = "stop:test_gate stop:test_game stop:test_game stop:test_db stop:test_log"
+	if got := log.take(); got != want {
+		t.Fatalf("stop order %q, want %q", got, want)
+	}
+}
+
+func TestStartCycle(t *testing.T) {
+	resetModules(t)
+	log := &hookLog{}
+	for _, name := range []string{"test_a", "test_b", "test_c"} {
+		GetModule(name)
+	}
+	SetLifecycle("test_a", log.lifecycle("test_a", "test_b"))
+	SetLifecycle("test_b", log.lifecycle("test_b", "test_c"))
+	SetLifecycle("test_c", log.lifecycle("test_c", "test_a"))
+
+	err := Start()
+	if !errors.Is(err, ErrModuleCycle) || !strings.Contains(err.Error(), "test_a -> test_b -> test_c -> test_a") {
+		t.Fatalf("start: %v, want the cycle", err)
+	}
+	if got := log.take(); got != "" {
+		t.Fatalf("hooks called %q", got)
+	}
+}
+
+func TestStartMissingDependency(t *testing.T) {
+	resetModules(t)
+	log := &hookLog{}
+	GetModule("test_a")
+	SetLifecycle("test_a", log.lifecycle("test_a", "test_missing"))
+
+	err := Start()
+	if !errors.Is(err, ErrModuleDependency) || !strings.Contains(err.Error(), "test_missing") {
+		t.Fatalf("start: %v, want the missing dependency", err)
+	}
+	if got := log.take(); got != "" {
+		t.Fatalf("hooks called %q", got)
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	resetModules(t)
+	log := &hookLog{}
+	GetModule("test_first")
+	GetModule("test_slow")
+	GetModule("test_after")
+	SetLifecycle("test_first", log.lifecycle("test_first"))
+	SetLifecycle("test_slow", Lifecycle{
+		DependsOn: []string{"test_first"},
+		OnStart: func(Context) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		},
+		StartTimeout: 50,
+	})
+	SetLifecycle("test_after", log.lifecycle("test_after", "test_slow"))
+
+	begin := time.Now()
+	err := Start()
+	if !errors.Is(err, ErrModuleTimeout) || !strings.Contains(err.Error(), "test_slow") {
+		t.Fatalf("start: %v, want the timeout", err)
+	}
+	if d := time.Since(begin); d > time.Second {
+		t.Fatalf("start failed after %v", d)
+	}
+	if got := log.take(); got != "start:test_first stop:test_first" {
+		t.Fatalf("hooks %q, want the started module stopped", got)
+	}
+}
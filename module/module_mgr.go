@@ -17,20 +17,6 @@ func GenModuleID() AgentID {
 	return agent.GenAgentID()
 }
 
-func Close() {
-	module_map.Range(func(k interface{}, m interface{}) bool {
-		m.(ModuleWoker).Close()
-		return true
-	})
-
-	worker_pools_map.Range(func(k interface{}, m interface{}) bool {
-		m.(*ModuleWorkerPool).Close()
-		return true
-	})
-
-	wait_close.Wait()
-}
-
 func NewModule(name string) Module {
 	m := &module{
 		id:            GenModuleID(),
@@ -42,11 +28,15 @@ func NewModule(name string) Module {
 		agentMap:      make(map[AgentID]Agent),
 		commgrMap:     make(map[ComponentID]ComponentMgr),
 		componentMap:  make(map[ComponentID]Component),
+		groupMap:      make(map[string]*SessionGroup),
+		agentGroups:   make(map[AgentID][]*SessionGroup),
+		rpcCallMap:    make(map[uint64]*rpcCall),
 		rpcMsgPool:    &sync.Pool{New: func() interface{} { return new(RpcEventMsg) }},
 		dataMsgPool:   &sync.Pool{New: func() interface{} { return new(DataEventMsg) }},
 		eventMsgPool:  &sync.Pool{New: func() interface{} { return new(SessionEventMsg) }},
 		awaitMsgPool:  &sync.Pool{New: func() interface{} { return new(AwaitRpcEventMsg) }},
 		closeChan:     make(chan bool),
+		exitChan:      make(chan struct{}),
 		eventList:     make([]interface{}, MODULE_EVENT_LENGTH),
 	}
 	m.context = &ModuleContext{m: m}
@@ -75,14 +65,11 @@ func FindModule(name string) Module {
 	return nil
 }
 
-func Start() {
+func ModuleNames() []string {
+	names := make([]string, 0, 8)
 	module_map.Range(func(k interface{}, m interface{}) bool {
-		go func(m interface{}) { m.(ModuleWoker).Run(&wait_close) }(m)
-		return true
-	})
-
-	worker_pools_map.Range(func(k interface{}, m interface{}) bool {
-		m.(*ModuleWorkerPool).Start()
+		names = append(names, k.(string))
 		return true
 	})
+	return names
 }
@@ -0,0 +1,83 @@
+package module
+
+import (
+	"errors"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+var (
+	ErrRpcTimeout   = errors.New("rpc call timeout")
+	ErrRpcNoHandler = errors.New("rpc handler not registered")
+)
+
+type rpcCall struct {
+	cb      RpcCallback
+	timerID uint64
+}
+
+type rpcCaller interface {
+	Agent
+	addRpcCall(RpcCallback, uint64) uint64
+}
+
+// NewRpcSession registers cb on the caller module, the reply must be pushed
+// back to the caller as an RpcReplyEventMsg carrying the returned session.
+func NewRpcSession(caller Module, cb RpcCallback, timeout uint64) uint64 {
+	c, ok := caller.(rpcCaller)
+	if !ok {
+		slog.LogError("module", "rpc session from unsupported caller [%v]", caller)
+		return 0
+	}
+	return c.addRpcCall(cb, timeout)
+}
+
+func (m *module) addRpcCall(cb RpcCallback, timeout uint64) uint64 {
+	m.rpcSession++
+	if m.rpcSession == 0 {
+		m.rpcSession = 1
+	}
+	session := m.rpcSession
+	call := &rpcCall{cb: cb}
+	if timeout > 0 {
+		call.timerID = m.timerManager.AddTimer(timeout, m.onRpcTimeout, session)
+	}
+	m.rpcCallMap[session] = call
+	return session
+}
+
+func (m *module) onRpcTimeout(args []interface{}) {
+	session := args[0].(uint64)
+	call, ok := m.rpcCallMap[session]
+	if !ok {
+		return
+	}
+	delete(m.rpcCallMap, session)
+	m.doRpcCallback(call.cb, nil, nil, ErrRpcTimeout)
+}
+
+func (m *module) doRpcCallback(cb RpcCallback, sender Agent, reply []interface{}, err error) {
+	if cb == nil {
+		return
+	}
+	ctx := m.context
+	ctx.s = sender
+	cb(ctx, reply, err)
+	ctx.Reset()
+}
+
+func replyRpc(sender Agent, to Agent, session uint64, reply []interface{}, err error) {
+	r, ok := to.(EventReceiver)
+	if !ok {
+		slog.LogError("module", "rpc reply session [%v] receiver [%v] unsupported", session, to)
+		return
+	}
+	e := &RpcReplyEventMsg{}
+	e.MsgType = event.EVENT_MODULE_RPC_REPLY
+	e.Sender = sender
+	e.Session = session
+	e.Data = reply
+	e.Err = err
+	r.PushEventMsg(e)
+}
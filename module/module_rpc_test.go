@@ -0,0 +1,65 @@
+package module
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type callReply struct {
+	reply []interface{}
+	err   error
+}
+
+// callFrom calls the rpc [name] of target in the goroutine of caller.
+func callFrom(caller *module, target Module, name string, timeout uint64, args ...interface{}) chan callReply {
+	c := make(chan callReply, 1)
+	caller.push(&moduleAction{f: func() {
+		target.Call(caller, name, timeout, func(ctx Context, r []interface{}, err error) {
+			c <- callReply{r, err}
+		}, args...)
+	}})
+	return c
+}
+
+func waitReply(t *testing.T, c chan callReply) callReply {
+	t.Helper()
+	select {
+	case r := <-c:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("call not answered")
+	}
+	return callReply{}
+}
+
+func TestModuleCall(t *testing.T) {
+	caller := runTestModule(t, "test_call_caller")
+	m := runTestModule(t, "test_call_callee")
+	m.RegisterRpcHandler("add", func(ctx Context, args *ArgsVar) {
+		ctx.Done(args.ReadInt(0) + args.ReadInt(1))
+	})
+	m.RegisterRpcHandler("never", func(ctx Context, args *ArgsVar) {})
+
+	r := waitReply(t, callFrom(caller, m, "add", 1000, 1, 2))
+	if r.err != nil || len(r.reply) != 1 || r.reply[0] != 3 {
+		t.Fatalf("add reply %v %v", r.reply, r.err)
+	}
+
+	begin := time.Now()
+	r = waitReply(t, callFrom(caller, m, "never", 50))
+	if !errors.Is(r.err, ErrRpcTimeout) {
+		t.Fatalf("never reply %v %v, want ErrRpcTimeout", r.reply, r.err)
+	}
+	if d := time.Since(begin); d < 40*time.Millisecond {
+		t.Fatalf("timeout after %v", d)
+	}
+
+	r = waitReply(t, callFrom(caller, m, "missing", 1000))
+	if !errors.Is(r.err, ErrRpcNoHandler) {
+		t.Fatalf("missing reply %v %v, want ErrRpcNoHandler", r.reply, r.err)
+	}
+	if r := m.AwaitRpcCall("missing"); len(r) != 1 || r[0] != ErrRpcNoHandler {
+		t.Fatalf("await missing reply %v", r)
+	}
+}
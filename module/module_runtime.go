@@ -0,0 +1,197 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jslyzt/einx/network"
+	"github.com/jslyzt/einx/slog"
+)
+
+var (
+	ErrModuleNotFound   = errors.New("module not found")
+	ErrModuleNotRunning = errors.New("modules not running")
+	ErrModuleStarted    = errors.New("module already started")
+	ErrModuleInUse      = errors.New("module depended on by a started module")
+	ErrModuleClosed     = errors.New("module closed")
+)
+
+// StartModule starts the module or worker pool [name] created after Start,
+// e.g. a module per dungeon instance. Its handlers and lifecycle are set up
+// before, the modules it depends on must be started.
+func StartModule(name string) error {
+	runtime_lock.Lock()
+	defer runtime_lock.Unlock()
+
+	lifecycle_lock.Lock()
+	running := modules_running
+	_, started := findStarted(name)
+	l := lifecycle_map[name]
+	lifecycle_lock.Unlock()
+	if !running {
+		return fmt.Errorf("%w: start [%s]", ErrModuleNotRunning, name)
+	}
+	if started {
+		return fmt.Errorf("%w: [%s]", ErrModuleStarted, name)
+	}
+	u := findUnit(name)
+	if u == nil {
+		return fmt.Errorf("%w: [%s]", ErrModuleNotFound, name)
+	}
+	for _, m := range u.modules {
+		if m.isExited() {
+			return fmt.Errorf("%w: start [%s]", ErrModuleClosed, name)
+		}
+	}
+	u.cycle = l
+	for _, dep := range l.DependsOn {
+		lifecycle_lock.Lock()
+		_, ok := findStarted(dep)
+		lifecycle_lock.Unlock()
+		if !ok {
+			return fmt.Errorf("%w: [%s] depends on [%s] not started", ErrModuleDependency, name, dep)
+		}
+	}
+	if err := u.init(); err != nil {
+		return err
+	}
+
+	lifecycle_lock.Lock()
+	started_units = append(started_units, u)
+	lifecycle_lock.Unlock()
+	if err := u.start(); err != nil {
+		removeStarted(u)
+		u.stop()
+		return err
+	}
+	slog.LogInfo("module", "module [%s] started", name)
+	return nil
+}
+
+// RemoveModule stops the module or worker pool [name] and unregisters it, the
+// name can be used by a new module then. The agents and components of the
+// module are closed, the events pending or sent later are dropped, rpc calls
+// among them are answered with ErrModuleClosed.
+func RemoveModule(name string) error {
+	runtime_lock.Lock()
+	defer runtime_lock.Unlock()
+
+	lifecycle_lock.Lock()
+	u, started := findStarted(name)
+	if started {
+		for _, s := range started_units {
+			for _, dep := range s.cycle.DependsOn {
+				if dep == name {
+					lifecycle_lock.Unlock()
+					return fmt.Errorf("%w: [%s] by [%s]", ErrModuleInUse, name, s.name)
+				}
+			}
+		}
+	}
+	lifecycle_lock.Unlock()
+
+	var err error
+	if started {
+		removeStarted(u)
+		if !u.stop() {
+			err = fmt.Errorf("%w: remove [%s]", ErrModuleTimeout, name)
+		}
+	} else if u = findUnit(name); u != nil {
+		for _, m := range u.modules {
+			if !m.isExited() {
+				m.doClose(nil) // never run
+			}
+		}
+	} else {
+		return fmt.Errorf("%w: [%s]", ErrModuleNotFound, name)
+	}
+
+	module_map.Delete(name)
+	worker_pools_map.Delete(name)
+	lifecycle_lock.Lock()
+	delete(lifecycle_map, name)
+	lifecycle_lock.Unlock()
+	supervisor_lock.Lock()
+	delete(supervisor_map, name)
+	supervisor_lock.Unlock()
+	slog.LogInfo("module", "module [%s] removed", name)
+	return err
+}
+
+func findUnit(name string) *lifecycleUnit {
+	if v, ok := module_map.Load(name); ok {
+		return newUnit(name, v)
+	}
+	if v, ok := worker_pools_map.Load(name); ok {
+		return newUnit(name, v)
+	}
+	return nil
+}
+
+// findStarted is called with lifecycle_lock held.
+func findStarted(name string) (*lifecycleUnit, bool) {
+	for _, u := range started_units {
+		if u.name == name {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+func removeStarted(u *lifecycleUnit) {
+	lifecycle_lock.Lock()
+	for i, s := range started_units {
+		if s == u {
+			started_units = append(started_units[:i], started_units[i+1:]...)
+			break
+		}
+	}
+	lifecycle_lock.Unlock()
+}
+
+func (m *module) isExited() bool {
+	return atomic.LoadInt32(&m.exited) != 0
+}
+
+// drainEvents drops the events left when the module exits.
+func (m *module) drainEvents() {
+	for ; m.eventIndex < m.eventCount; m.eventIndex++ {
+		m.dropEvent(m.eventList[m.eventIndex].(EventMsg), ErrModuleClosed)
+		m.eventList[m.eventIndex] = nil
+	}
+	for {
+		n := m.evQueue.Get(m.eventList, uint32(MODULE_EVENT_LENGTH))
+		if n == 0 {
+			break
+		}
+		for i := uint32(0); i < n; i++ {
+			m.dropEvent(m.eventList[i].(EventMsg), ErrModuleClosed)
+			m.eventList[i] = nil
+		}
+	}
+	m.eventIndex, m.eventCount = 0, 0
+}
+
+// dropEvent releases an event the module will not handle and answers the
+// callers waiting for it with err.
+func (m *module) dropEvent(ev EventMsg, err error) {
+	switch e := ev.(type) {
+	case *DataEventMsg:
+		if mb, ok := e.MsgData.(*network.MsgBuffer); ok {
+			mb.Release()
+		}
+	case *RpcEventMsg:
+		if e.Session != 0 {
+			replyRpc(m, e.Sender, e.Session, nil, err)
+		}
+	case *AwaitRpcEventMsg:
+		e.Await <- []interface{}{err}
+	case *actorMsg:
+		if e.session != 0 {
+			replyRpc(m, e.sender, e.session, nil, err)
+		}
+	case *moduleAction:
+		e.drop()
+	}
+}
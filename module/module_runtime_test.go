@@ -0,0 +1,161 @@
+package module
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jslyzt/einx/network"
+)
+
+func TestStartModule(t *testing.T) {
+	resetModules(t)
+	GetModule("test_base")
+	if err := StartModule("test_base"); !errors.Is(err, ErrModuleNotRunning) {
+		t.Fatalf("start before Start: %v", err)
+	}
+	if err := Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := StartModule("test_base"); !errors.Is(err, ErrModuleStarted) {
+		t.Fatalf("start twice: %v", err)
+	}
+	if err := StartModule("test_missing"); !errors.Is(err, ErrModuleNotFound) {
+		t.Fatalf("start a missing module: %v", err)
+	}
+
+	GetModule("test_orphan")
+	SetLifecycle("test_orphan", Lifecycle{DependsOn: []string{"test_idle"}})
+	GetModule("test_idle")
+	if err := StartModule("test_orphan"); !errors.Is(err, ErrModuleDependency) {
+		t.Fatalf("start before its dependency: %v", err)
+	}
+
+	dungeon := GetModule("test_dungeon").(*module)
+	SetLifecycle("test_dungeon", Lifecycle{DependsOn: []string{"test_base"}})
+	dungeon.RegisterRpcHandler("id", func(ctx Context, args *ArgsVar) { ctx.Done(1) })
+	if err := StartModule("test_dungeon"); err != nil {
+		t.Fatalf("start a dungeon: %v", err)
+	}
+	if r := dungeon.AwaitRpcCall("id"); len(r) != 1 || r[0] != 1 {
+		t.Fatalf("dungeon reply %v", r)
+	}
+
+	if err := RemoveModule("test_base"); !errors.Is(err, ErrModuleInUse) {
+		t.Fatalf("remove a dependency: %v", err)
+	}
+	if err := RemoveModule("test_dungeon"); err != nil {
+		t.Fatalf("remove the dungeon: %v", err)
+	}
+	if err := RemoveModule("test_dungeon"); !errors.Is(err, ErrModuleNotFound) {
+		t.Fatalf("remove twice: %v", err)
+	}
+	if err := StartModule("test_dungeon"); !errors.Is(err, ErrModuleNotFound) {
+		t.Fatalf("start a removed module: %v", err)
+	}
+
+	// the name is free for a new module
+	again := GetModule("test_dungeon").(*module)
+	if again == dungeon {
+		t.Fatalf("removed module reused")
+	}
+	again.RegisterRpcHandler("id", func(ctx Context, args *ArgsVar) { ctx.Done(2) })
+	SetLifecycle("test_dungeon", Lifecycle{DependsOn: []string{"test_base"}})
+	if err := StartModule("test_dungeon"); err != nil {
+		t.Fatalf("start the dungeon again: %v", err)
+	}
+	if r := again.AwaitRpcCall("id"); len(r) != 1 || r[0] != 2 {
+		t.Fatalf("new dungeon reply %v", r)
+	}
+	if err := RemoveModule("test_dungeon"); err != nil {
+		t.Fatalf("remove the new dungeon: %v", err)
+	}
+	if err := RemoveModule("test_base"); err != nil {
+		t.Fatalf("remove the base once unused: %v", err)
+	}
+}
+
+func TestRemoveModuleInFlight(t *testing.T) {
+	resetModules(t)
+	caller := runTestModule(t, "test_remove_caller")
+	m := GetModule("test_remove").(*module)
+	if err := Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	handled := make(chan string, 4)
+	m.RegisterRpcHandler("rpc", func(ctx Context, args *ArgsVar) { handled <- "rpc" })
+	m.RegisterHandler(1, func(ctx Context, msg interface{}) { handled <- "msg" })
+
+	// the actor stops once the module took the close, the events sent then
+	// are left in the queue
+	replies := make(chan callReply, 1)
+	mb := network.NewMsgBuffer([]byte("body"))
+	stopping := func(a *Actor) {
+		sent := make(chan struct{})
+		caller.push(&moduleAction{f: func() {
+			m.Call(caller, "rpc", 1000, func(ctx Context, r []interface{}, err error) {
+				replies <- callReply{r, err}
+			})
+			close(sent)
+		}})
+		<-sent
+		m.RouterMsg(&testAgent{id: 1}, 1, mb)
+	}
+	if _, err := SpawnActor(m, 201, &ActorSpec{OnStop: stopping}, nil); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	inModule(t, m, func() {})
+
+	if err := RemoveModule("test_remove"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	r := waitReply(t, replies)
+	if !errors.Is(r.err, ErrModuleClosed) {
+		t.Fatalf("pending rpc reply %v %v, want ErrModuleClosed", r.reply, r.err)
+	}
+	if mb.Len() != 0 {
+		t.Fatalf("pending msg buffer not released")
+	}
+	select {
+	case h := <-handled:
+		t.Fatalf("%s handled after the close", h)
+	default:
+	}
+
+	// and the events sent after the exit
+	if r := m.AwaitRpcCall("rpc"); len(r) != 1 || !errors.Is(r[0].(error), ErrModuleClosed) {
+		t.Fatalf("await after remove %v", r)
+	}
+	r = waitReply(t, callFrom(caller, m, "rpc", 1000))
+	if !errors.Is(r.err, ErrModuleClosed) {
+		t.Fatalf("call after remove %v %v", r.reply, r.err)
+	}
+	mb = network.NewMsgBuffer([]byte("late"))
+	m.RouterMsg(&testAgent{id: 1}, 1, mb)
+	if mb.Len() != 0 {
+		t.Fatalf("late msg buffer not released")
+	}
+}
+
+func TestRemoveModuleNeverStarted(t *testing.T) {
+	resetModules(t)
+	if err := Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	m := GetModule("test_never").(*module)
+	m.RegisterRpcHandler("rpc", func(ctx Context, args *ArgsVar) { ctx.Done(1) })
+	if err := RemoveModule("test_never"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	select {
+	case <-m.exitChan:
+	case <-time.After(time.Second):
+		t.Fatal("never started module not closed")
+	}
+	if FindModule("test_never") != nil {
+		t.Fatalf("removed module still registered")
+	}
+	if r := m.AwaitRpcCall("rpc"); len(r) != 1 || !errors.Is(r[0].(error), ErrModuleClosed) {
+		t.Fatalf("await after remove %v", r)
+	}
+}
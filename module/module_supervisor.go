@@ -0,0 +1,250 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+type SupervisePolicy int
+
+const (
+	SUPERVISE_RESTART  SupervisePolicy = iota // drop the event and restart the loop after the backoff
+	SUPERVISE_DROP                            // drop the event and go on at once, never escalates
+	SUPERVISE_ESCALATE                        // stop the module and shut the process down
+)
+
+// Supervisor decides what a module does when its event loop panics. The
+// event being handled is never retried. A restarted module escalates once it
+// restarted more than MaxRestarts times within Window.
+type Supervisor struct {
+	Policy      SupervisePolicy
+	Backoff     int64 //Millisecond, doubled on each restart within Window
+	MaxBackoff  int64 //Millisecond
+	MaxRestarts int   //0 is unlimited
+	Window      int64 //Millisecond
+	OnPanic     func(*PanicInfo)
+}
+
+// PanicInfo reports a panic of a module event loop.
+type PanicInfo struct {
+	Module    string
+	EventType EventType // EVENT_NONE when a timer panicked
+	Handler   string    // the msg id or rpc name with the handler func
+	Value     interface{}
+	Stack     []byte
+	Policy    SupervisePolicy
+}
+
+type SupervisorStats struct {
+	Panics   int64
+	Restarts int64
+	Drops    int64
+}
+
+var ErrModulePanic = errors.New("module panic")
+
+var DefaultSupervisor = Supervisor{
+	Policy:     SUPERVISE_RESTART,
+	Backoff:    10,
+	MaxBackoff: 1000,
+	Window:     60000,
+}
+
+var (
+	supervisor_lock sync.Mutex
+	supervisor_map  = make(map[string]Supervisor)
+)
+
+// SetSupervisor sets the supervisor of the module or worker pool [name],
+// DefaultSupervisor is used for the others.
+func SetSupervisor(name string, s Supervisor) {
+	supervisor_lock.Lock()
+	supervisor_map[name] = s
+	supervisor_lock.Unlock()
+}
+
+func getSupervisor(m *module) Supervisor {
+	supervisor_lock.Lock()
+	defer supervisor_lock.Unlock()
+	if s, ok := supervisor_map[m.name]; ok {
+		return s
+	}
+	if s, ok := supervisor_map[m.pool]; ok && m.pool != "" {
+		return s
+	}
+	return DefaultSupervisor
+}
+
+// GetSupervisorStats returns the panic counters of the module [name], summed
+// over the workers for a worker pool.
+func GetSupervisorStats(name string) (SupervisorStats, bool) {
+	var stats SupervisorStats
+	add := func(m *module) {
+		stats.Panics += atomic.LoadInt64(&m.stats.Panics)
+		stats.Restarts += atomic.LoadInt64(&m.stats.Restarts)
+		stats.Drops += atomic.LoadInt64(&m.stats.Drops)
+	}
+	if v, ok := module_map.Load(name); ok {
+		add(v.(*module))
+		return stats, true
+	}
+	if v, ok := worker_pools_map.Load(name); ok {
+		for _, m := range v.(*ModuleWorkerPool).modules {
+			add(m.(*module))
+		}
+		return stats, true
+	}
+	return stats, false
+}
+
+type supervisorState struct {
+	restarts    []int64 // restart times within the window
+	nextBackoff int64
+}
+
+// onPanic is called in the recover of the event loop, it reports the panic
+// and cleans up the state left by the handler. The caller waiting for the
+// event gets ErrModulePanic.
+func (m *module) onPanic(r interface{}, stack []byte) *PanicInfo {
+	atomic.AddInt64(&m.stats.Panics, 1)
+	info := &PanicInfo{
+		Module:    m.name,
+		EventType: event.EVENT_NONE,
+		Value:     r,
+		Stack:     stack,
+	}
+	if ev := m.curEvent; ev != nil {
+		info.EventType = ev.GetType()
+		info.Handler = m.describeHandler(ev)
+		err := fmt.Errorf("%w: %v", ErrModulePanic, r)
+		if c := m.curCtx; c != nil {
+			replyFunc(c, nil, err) // the handler may have replied already
+		} else {
+			m.dropEvent(ev, err)
+		}
+	}
+	m.curEvent, m.curCtx = nil, nil
+	m.context.Reset()
+	m.args.clear()
+
+	s := getSupervisor(m)
+	info.Policy = s.Policy
+	slog.LogError("module_recovery", "module [%s] panic in event [%d] %s: %v", m.name, info.EventType, info.Handler, r)
+	slog.LogError("module_recovery", "%s", string(stack))
+	if s.OnPanic != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.LogError("module_recovery", "module [%s] OnPanic panic: %v", m.name, r)
+				}
+			}()
+			s.OnPanic(info)
+		}()
+	}
+	return info
+}
+
+// supervise applies the policy after a panic, it returns false when the module
+// has to stop.
+func (m *module) supervise() bool {
+	s := getSupervisor(m)
+	switch s.Policy {
+	case SUPERVISE_DROP:
+		atomic.AddInt64(&m.stats.Drops, 1)
+		return true
+	case SUPERVISE_ESCALATE:
+		escalate(m.name)
+		return false
+	}
+
+	st := &m.supervisor
+	now := time.Now().UnixNano() / 1e6
+	kept := st.restarts[:0]
+	for _, t := range st.restarts {
+		if s.Window <= 0 || now-t < s.Window {
+			kept = append(kept, t)
+		}
+	}
+	st.restarts = append(kept, now)
+	if s.MaxRestarts > 0 && len(st.restarts) > s.MaxRestarts {
+		slog.LogError("module_recovery", "module [%s] restarted %d times in %dms", m.name, len(st.restarts)-1, s.Window)
+		escalate(m.name)
+		return false
+	}
+
+	if len(st.restarts) == 1 || st.nextBackoff <= 0 {
+		st.nextBackoff = s.Backoff
+	}
+	if st.nextBackoff > 0 {
+		m.sleep(st.nextBackoff)
+		st.nextBackoff *= 2
+		if s.MaxBackoff > 0 && st.nextBackoff > s.MaxBackoff {
+			st.nextBackoff = s.MaxBackoff
+		}
+	}
+	atomic.AddInt64(&m.stats.Restarts, 1)
+	return true
+}
+
+// sleep waits the backoff unless the module is closed meanwhile.
+func (m *module) sleep(ms int64) {
+	t := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case close := <-m.closeChan:
+		if close {
+			m.closing = true
+		}
+	}
+}
+
+func (m *module) describeHandler(ev EventMsg) string {
+	switch e := ev.(type) {
+	case *DataEventMsg:
+		return fmt.Sprintf("msg [%d] %s", e.TypeID, funcName(m.msgHandlerMap[e.TypeID]))
+	case *RpcEventMsg:
+		return fmt.Sprintf("rpc [%s] %s", e.RpcName, funcName(m.rpcHandlerMap[e.RpcName]))
+	case *AwaitRpcEventMsg:
+		return fmt.Sprintf("rpc [%s] %s", e.RpcName, funcName(m.rpcHandlerMap[e.RpcName]))
+	case *actorMsg:
+		return fmt.Sprintf("actor [%d] [%s] %s", e.actor.id, e.name, funcName(e.actor.spec.Handlers[e.name]))
+	case CustomActionEventMsg:
+		return funcName(e.GetAction())
+	}
+	return ""
+}
+
+func funcName(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// escalate shuts the process down through the signal einx.Run waits for.
+func escalate(name string) {
+	slog.LogError("module_recovery", "module [%s] escalates the panic, shutting down", name)
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(os.Interrupt)
+	}
+	if err != nil {
+		slog.LogError("module_recovery", "escalate failed: %v", err)
+		slog.Close()
+		os.Exit(1)
+	}
+}
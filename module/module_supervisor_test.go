@@ -0,0 +1,100 @@
+package module
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func runTestModule(t *testing.T, name string) *module {
+	SetSupervisor(name, Supervisor{Policy: SUPERVISE_DROP})
+	m := NewModule(name).(*module)
+	wait_close.Add(1)
+	go m.Run(&wait_close)
+	t.Cleanup(func() {
+		m.Close()
+		<-m.exitChan
+		supervisor_lock.Lock()
+		delete(supervisor_map, name)
+		supervisor_lock.Unlock()
+	})
+	return m
+}
+
+func TestPanicAnswersAwaitRpc(t *testing.T) {
+	m := runTestModule(t, "test_panic_await")
+	m.RegisterRpcHandler("panic", func(ctx Context, args *ArgsVar) {
+		panic("boom")
+	})
+	m.RegisterRpcHandler("reply_then_panic", func(ctx Context, args *ArgsVar) {
+		ctx.Done(1)
+		panic("boom")
+	})
+
+	r := m.AwaitRpcCall("panic")
+	if len(r) != 1 {
+		t.Fatalf("panic reply %v", r)
+	}
+	if err, _ := r[0].(error); !errors.Is(err, ErrModulePanic) {
+		t.Fatalf("panic reply %v, want ErrModulePanic", r)
+	}
+	if n := atomic.LoadInt64(&m.stats.Panics); n != 1 {
+		t.Fatalf("panics %d, want 1", n)
+	}
+
+	r = m.AwaitRpcCall("reply_then_panic")
+	if len(r) != 1 || r[0] != 1 {
+		t.Fatalf("reply before panic %v", r)
+	}
+}
+
+func TestPanicAnswersCall(t *testing.T) {
+	caller := runTestModule(t, "test_panic_caller")
+	m := runTestModule(t, "test_panic_callee")
+	m.RegisterRpcHandler("panic", func(ctx Context, args *ArgsVar) {
+		panic("boom")
+	})
+	m.RegisterRpcHandler("reply_then_panic", func(ctx Context, args *ArgsVar) {
+		ctx.Done(1)
+		panic("boom")
+	})
+
+	type reply struct {
+		name  string
+		reply []interface{}
+		err   error
+	}
+	replies := make(chan reply, 4)
+	caller.push(&moduleAction{f: func() {
+		for _, name := range []string{"panic", "reply_then_panic"} {
+			name := name
+			m.Call(caller, name, 0, func(ctx Context, r []interface{}, err error) {
+				replies <- reply{name, r, err}
+			})
+		}
+	}})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-replies:
+			switch r.name {
+			case "panic":
+				if !errors.Is(r.err, ErrModulePanic) {
+					t.Fatalf("panic reply %v %v, want ErrModulePanic", r.reply, r.err)
+				}
+			case "reply_then_panic":
+				if r.err != nil || len(r.reply) != 1 || r.reply[0] != 1 {
+					t.Fatalf("reply before panic %v %v", r.reply, r.err)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("call not answered")
+		}
+	}
+	select {
+	case r := <-replies:
+		t.Fatalf("replied twice %v %v %v", r.name, r.reply, r.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
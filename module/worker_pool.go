@@ -10,11 +10,15 @@ import (
 
 var worker_pools_map sync.Map
 
+// WorkerPool routes to its workers with a WorkerRouter, as a ModuleRouter the
+// msgs and rpcs of an agent are routed by the agent id.
 type WorkerPool interface {
+	ModuleRouter
 	ForEachModule(func(m Module))
-	RegisterRpcHandler(string, RpcHandler)
-	RegisterHandler(ProtoTypeID, MsgHandler)
 	RpcCall(string, ...interface{})
+	Call(Module, string, uint64, RpcCallback, ...interface{})
+	SetRouter(WorkerRouter)
+	Route(uint64) Module
 	Balancer() Module
 	Const(string) Module
 	Slot(int) Module
@@ -25,16 +29,18 @@ type ModuleWorkerPool struct {
 	name       string
 	balance_id uint32
 	size       uint32
+	router     WorkerRouter
 }
 
 func CreateWorkers(name string, size int) WorkerPool {
 	w := GetWorkerPool(name).(*ModuleWorkerPool)
 	w.size = uint32(size)
-	if w.modules == nil {
+	if len(w.modules) != size {
 		w.modules = make([]Module, size)
 	}
 	for i := 0; i < size; i++ {
 		m := NewModule(fmt.Sprintf("%s_worker_%d", name, i+1))
+		m.(*module).pool = name
 		w.modules[i] = m
 	}
 	return w
@@ -49,14 +55,33 @@ func GetWorkerPool(name string) WorkerPool {
 			name:       name,
 			balance_id: 0,
 			size:       0,
+			router:     DefaultWorkerRouter,
 		}
 		worker_pools_map.Store(name, w)
 		return w
 	}
 }
 
+func FindWorkerPool(name string) WorkerPool {
+	v, ok := worker_pools_map.Load(name)
+	if ok {
+		return v.(WorkerPool)
+	}
+	return nil
+}
+
+func WorkerPoolNames() []string {
+	names := make([]string, 0, 4)
+	worker_pools_map.Range(func(k interface{}, w interface{}) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	return names
+}
+
 func (pool *ModuleWorkerPool) Start() {
 	for _, m := range pool.modules {
+		wait_close.Add(1)
 		go func(m Module) { m.(ModuleWoker).Run(&wait_close) }(m)
 	}
 }
@@ -87,35 +112,70 @@ func (pool *ModuleWorkerPool) RegisterHandler(type_id ProtoTypeID, f MsgHandler)
 }
 
 func (pool *ModuleWorkerPool) RpcCall(name string, args ...interface{}) {
-	var hashkey uint32 = 0
-	length := len(name)
-	if length > 0 {
-		hashkey += uint32(name[0])
-		hashkey += uint32(name[length-1])
-		hashkey += uint32(name[(length-1)/2])
-		hashkey += uint32(length)
-	}
-	m := pool.modules[hashkey%pool.size] //route the rpc to worker by a simple hash key
-	m.RpcCall(name, args...)
+	pool.Const(name).RpcCall(name, args...)
+}
+
+func (pool *ModuleWorkerPool) Call(caller Module, name string, timeout uint64, cb RpcCallback, args ...interface{}) {
+	pool.Const(name).Call(caller, name, timeout, cb, args...)
+}
+
+// SetRouter sets the router of the pool before it is used, HashRouter by
+// default.
+func (pool *ModuleWorkerPool) SetRouter(r WorkerRouter) {
+	pool.router = r
+}
+
+// Route returns the worker of key, e.g. a player id, or the least loaded
+// worker with a LeastLoadedRouter.
+func (pool *ModuleWorkerPool) Route(key uint64) Module {
+	return pool.modules[pool.router.Route(key, len(pool.modules), pool.load)]
 }
 
+func (pool *ModuleWorkerPool) load(i int) int {
+	return pool.modules[i].(*module).evQueue.Count()
+}
+
+// Balancer returns the next worker of a round robin, or the least loaded one
+// with a LeastLoadedRouter.
 func (pool *ModuleWorkerPool) Balancer() Module {
-	idx := atomic.AddUint32(&pool.balance_id, 1) % pool.size
-	return pool.modules[idx]
+	idx := atomic.AddUint32(&pool.balance_id, 1)
+	if isBalanced(pool.router) {
+		return pool.Route(uint64(idx))
+	}
+	return pool.modules[idx%pool.size]
 }
 
+// Const returns the worker of the string key n, the rpcs by name go to it.
 func (pool *ModuleWorkerPool) Const(n string) Module {
-	var hashkey uint32 = 0
-	length := len(n)
-	if length > 0 {
-		hashkey += uint32(n[0])
-		hashkey += uint32(n[length-1])
-		hashkey += uint32(n[(length-1)/2])
-		hashkey += uint32(length)
-	}
-	return pool.modules[hashkey%pool.size]
+	return pool.sticky(HashString(n))
 }
 
+// Slot returns the worker n modulo the pool size.
 func (pool *ModuleWorkerPool) Slot(n int) Module {
 	return pool.modules[uint32(n)%pool.size]
 }
+
+// sticky returns the worker keeping key, a LeastLoadedRouter is not sticky so
+// the key is hashed then.
+func (pool *ModuleWorkerPool) sticky(key uint64) Module {
+	if isBalanced(pool.router) {
+		return pool.modules[HashRouter{}.Route(key, len(pool.modules), nil)]
+	}
+	return pool.Route(key)
+}
+
+func (pool *ModuleWorkerPool) agentWorker(agent Agent) ModuleRouter {
+	return pool.sticky(uint64(agent.GetID())).(ModuleRouter)
+}
+
+func (pool *ModuleWorkerPool) RouterMsg(agent Agent, msgID ProtoTypeID, msg interface{}) {
+	pool.agentWorker(agent).RouterMsg(agent, msgID, msg)
+}
+
+func (pool *ModuleWorkerPool) RouterRpc(agent Agent, name string, args []interface{}) {
+	pool.agentWorker(agent).RouterRpc(agent, name, args)
+}
+
+func (pool *ModuleWorkerPool) RouterCall(agent Agent, session uint64, name string, args []interface{}) {
+	pool.agentWorker(agent).RouterCall(agent, session, name, args)
+}
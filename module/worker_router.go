@@ -0,0 +1,121 @@
+package module
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// WorkerRouter picks the worker of a key among size workers, load returns
+// the events queued on a worker.
+type WorkerRouter interface {
+	Route(key uint64, size int, load func(int) int) int
+}
+
+// HashRouter spreads the keys evenly, a key moves when the pool is resized.
+type HashRouter struct{}
+
+// ConsistentRouter maps the keys on a hash ring, resizing a pool from n to m
+// workers only moves about |n-m|/max(n,m) of the keys.
+type ConsistentRouter struct {
+	Replicas int // virtual nodes per worker, 160 by default
+
+	lock  sync.Mutex   // held to build a ring
+	rings atomic.Value // map[int][]ringNode, copied on write
+}
+
+// LeastLoadedRouter routes to the worker with the fewest queued events, it
+// is not sticky.
+type LeastLoadedRouter struct{}
+
+type ringNode struct {
+	hash   uint64
+	worker int
+}
+
+var DefaultWorkerRouter WorkerRouter = HashRouter{}
+
+// HashString is the 64 bit fnv-1a hash of s.
+func HashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// HashUint64 mixes the bits of x, sequential ids get unrelated hashes.
+func HashUint64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (HashRouter) Route(key uint64, size int, load func(int) int) int {
+	return int(HashUint64(key) % uint64(size))
+}
+
+func (r *ConsistentRouter) Route(key uint64, size int, load func(int) int) int {
+	ring := r.ring(size)
+	h := HashUint64(key)
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].worker
+}
+
+func (r *ConsistentRouter) ring(size int) []ringNode {
+	rings, _ := r.rings.Load().(map[int][]ringNode)
+	if ring, ok := rings[size]; ok {
+		return ring
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rings, _ = r.rings.Load().(map[int][]ringNode)
+	if ring, ok := rings[size]; ok {
+		return ring
+	}
+	replicas := r.Replicas
+	if replicas <= 0 {
+		replicas = 160
+	}
+	ring := make([]ringNode, 0, size*replicas)
+	for w := 0; w < size; w++ {
+		for v := 0; v < replicas; v++ {
+			ring = append(ring, ringNode{hash: HashUint64(uint64(w)<<32 | uint64(v)), worker: w})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	next := make(map[int][]ringNode, len(rings)+1)
+	for k, v := range rings {
+		next[k] = v
+	}
+	next[size] = ring
+	r.rings.Store(next)
+	return ring
+}
+
+func (LeastLoadedRouter) balanced() {}
+
+// isBalanced reports a router that does not keep a key on a worker.
+func isBalanced(r WorkerRouter) bool {
+	_, ok := r.(interface{ balanced() })
+	return ok
+}
+
+func (LeastLoadedRouter) Route(key uint64, size int, load func(int) int) int {
+	start := int(key % uint64(size))
+	best, min := start, -1
+	for i := 0; i < size; i++ {
+		w := (start + i) % size
+		if l := load(w); min < 0 || l < min {
+			best, min = w, l
+		}
+	}
+	return best
+}
@@ -0,0 +1,95 @@
+package module
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashStringSpread(t *testing.T) {
+	const keys = 100000
+	for _, size := range []int{2, 8, 16, 30} {
+		counts := make([]int, size)
+		for i := 0; i < keys; i++ {
+			counts[HashString(fmt.Sprintf("player_%d", i))%uint64(size)]++
+		}
+		mean := float64(keys) / float64(size)
+		for w, c := range counts {
+			if d := (float64(c) - mean) / mean; d > 0.05 || d < -0.05 {
+				t.Errorf("size %d worker %d got %d keys, mean %.0f", size, w, c, mean)
+			}
+		}
+	}
+}
+
+func TestConsistentRouterResize(t *testing.T) {
+	const keys = 100000
+	r := &ConsistentRouter{}
+	for _, resize := range [][2]int{{8, 9}, {9, 8}, {4, 5}, {16, 17}} {
+		from, to := resize[0], resize[1]
+		moved := 0
+		for k := uint64(0); k < keys; k++ {
+			a, b := r.Route(k, from, nil), r.Route(k, to, nil)
+			if a == b {
+				continue
+			}
+			moved++
+			if to > from && b < from {
+				t.Fatalf("%d -> %d: key %d moved between the old workers %d -> %d", from, to, k, a, b)
+			}
+			if to < from && a < to {
+				t.Fatalf("%d -> %d: key %d of a kept worker moved %d -> %d", from, to, k, a, b)
+			}
+		}
+		n := from
+		if to > n {
+			n = to
+		}
+		want := 1 / float64(n)
+		if got := float64(moved) / keys; got < want/2 || got > want*3/2 {
+			t.Errorf("%d -> %d moved %.3f of the keys, want about %.3f", from, to, got, want)
+		}
+	}
+}
+
+func TestHashRouterSequentialKeys(t *testing.T) {
+	const keys = 100000
+	for _, size := range []int{2, 7, 16} {
+		counts := make([]int, size)
+		for k := uint64(0); k < keys; k++ {
+			counts[HashRouter{}.Route(k, size, nil)]++
+		}
+		mean := float64(keys) / float64(size)
+		for w, c := range counts {
+			if d := (float64(c) - mean) / mean; d > 0.05 || d < -0.05 {
+				t.Errorf("size %d worker %d got %d keys, mean %.0f", size, w, c, mean)
+			}
+		}
+	}
+}
+
+func TestLeastLoadedRouter(t *testing.T) {
+	loads := []int{5, 2, 7, 2}
+	load := func(i int) int { return loads[i] }
+	for key, want := range map[uint64]int{0: 1, 1: 1, 2: 3, 3: 3, 5: 1} {
+		if w := (LeastLoadedRouter{}).Route(key, len(loads), load); w != want {
+			t.Errorf("key %d routed to %d, want %d", key, w, want)
+		}
+	}
+}
+
+func TestLeastLoadedPoolSticky(t *testing.T) {
+	pool := CreateWorkers("test_least_loaded_pool", 4).(*ModuleWorkerPool)
+	defer RemoveModule("test_least_loaded_pool")
+	pool.SetRouter(LeastLoadedRouter{})
+
+	w := pool.Const("login")
+	for i := 0; i < 8; i++ {
+		w.RpcCall("login") // the workers are not running, the rpcs stay queued
+	}
+	if pool.Const("login") != w {
+		t.Fatalf("Const moved to another worker with the load")
+	}
+	if pool.Route(1) == w || pool.Balancer() == w {
+		t.Fatalf("the loaded worker is picked by the least loaded router")
+	}
+}
@@ -0,0 +1,84 @@
+package network
+
+import (
+	"sync"
+)
+
+// BroadcastMsg is one msg queued to many linkers. Its packet is framed and
+// compressed once per transport option and the frame is shared by the
+// write queues, linkers with a session key still seal their own copy.
+// Buf must not be modified once the msg is queued.
+type BroadcastMsg struct {
+	msgID  ProtoTypeID
+	Buf    []byte
+	lock   sync.Mutex
+	frames []broadcastFrame
+}
+
+type broadcastFrame struct {
+	opt *TransportOption
+	b   []byte
+}
+
+func NewBroadcastMsg(msgID ProtoTypeID, b []byte) *BroadcastMsg {
+	return &BroadcastMsg{
+		msgID: msgID,
+		Buf:   b,
+	}
+}
+
+func (m *BroadcastMsg) GetType() byte {
+	return 'S'
+}
+
+func (m *BroadcastMsg) reset() {
+}
+
+// frame returns the packet of the msg for the linkers sharing opt.
+func (m *BroadcastMsg) frame(opt *TransportOption, c *packetCompressor) []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, f := range m.frames {
+		if f.opt == opt {
+			return f.b
+		}
+	}
+
+	b, flag := m.Buf, uint8(0)
+	if opt.compress_flag != 0 && len(b) >= opt.compress_threshold {
+		if cb, cflag, err := c.compress(opt.compress_flag, b); err == nil {
+			b, flag = cb, cflag
+		}
+	}
+	p := transPacket{
+		MsgType:    'P',
+		PacketFlag: flag,
+		BodyLength: uint32(len(b)),
+		MsgID:      m.msgID,
+	}
+	frame := make([]byte, MSG_HEADER_LENGTH+len(b))
+	p.encode(frame)
+	copy(frame[MSG_HEADER_LENGTH:], b)
+	m.frames = append(m.frames, broadcastFrame{opt: opt, b: frame})
+	return frame
+}
+
+// Broadcast queues msgID with the body b to every linker and returns how many
+// linkers accepted it.
+func Broadcast(linkers []NetLinker, msgID ProtoTypeID, b []byte) int {
+	m := NewBroadcastMsg(msgID, b)
+	count := 0
+	for _, l := range linkers {
+		t, ok := l.(ITransporter)
+		if !ok {
+			if l.WriteMsg(msgID, b) {
+				count++
+			}
+			continue
+		}
+		if !t.IsClosed() && t.doPushWrite(m) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/jslyzt/einx/slog"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrMsgUnregistered = errors.New("msg type not registered")
+	ErrMsgCodecType    = errors.New("msg type not supported by codec")
+)
+
+// Codec encodes msg bodies in one format.
+type Codec interface {
+	Name() string
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte, interface{}) error
+}
+
+var (
+	ProtoCodec Codec = protoCodec{}
+	JsonCodec  Codec = jsonCodec{}
+	RpcCodec   Codec = rpcCodec{}
+)
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrMsgCodecType
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrMsgCodecType
+	}
+	return proto.Unmarshal(b, m)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+// rpcCodec is the RpcMarshal format, msgs are *[]interface{} argument lists.
+type rpcCodec struct{}
+
+func (rpcCodec) Name() string {
+	return "rpc"
+}
+
+func (rpcCodec) Marshal(v interface{}) ([]byte, error) {
+	args, ok := v.(*[]interface{})
+	if !ok {
+		return nil, ErrMsgCodecType
+	}
+	return RpcEncode(nil, *args)
+}
+
+func (rpcCodec) Unmarshal(b []byte, v interface{}) error {
+	args, ok := v.(*[]interface{})
+	if !ok {
+		return ErrMsgCodecType
+	}
+	val, rest, err := RpcDecode(b)
+	if err != nil {
+		return err
+	}
+	list, ok := val.([]interface{})
+	if !ok || len(rest) != 0 {
+		return ErrMsgCodecType
+	}
+	*args = list
+	return nil
+}
+
+type msgType struct {
+	id    ProtoTypeID
+	t     reflect.Type
+	codec Codec
+}
+
+// the registry is filled at init and read by every network goroutine
+var (
+	msgTypeLock sync.RWMutex
+	msgTypeByID = make(map[ProtoTypeID]*msgType)
+	msgIDByType = make(map[reflect.Type]*msgType)
+)
+
+// RegisterMsg maps id to the type of msg, a pointer such as (*pb.Login)(nil),
+// whose bodies are encoded by codec. It panics on a duplicate id or type.
+func RegisterMsg(id ProtoTypeID, msg interface{}, codec Codec) {
+	t := reflect.TypeOf(msg)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic("register msg type must be a pointer")
+	}
+	msgTypeLock.Lock()
+	defer msgTypeLock.Unlock()
+	if _, ok := msgTypeByID[id]; ok {
+		panic("register msg id duplicated")
+	}
+	if _, ok := msgIDByType[t]; ok {
+		panic("register msg type duplicated")
+	}
+	mt := &msgType{id: id, t: t, codec: codec}
+	msgTypeByID[id] = mt
+	msgIDByType[t] = mt
+}
+
+// MsgTypeID returns the id msg was registered with.
+func MsgTypeID(msg interface{}) (ProtoTypeID, bool) {
+	msgTypeLock.RLock()
+	mt, ok := msgIDByType[reflect.TypeOf(msg)]
+	msgTypeLock.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	return mt.id, true
+}
+
+// DecodeMsg returns a new msg of the type registered for id decoded from b.
+func DecodeMsg(id ProtoTypeID, b []byte) (interface{}, error) {
+	msgTypeLock.RLock()
+	mt, ok := msgTypeByID[id]
+	msgTypeLock.RUnlock()
+	if !ok {
+		return nil, ErrMsgUnregistered
+	}
+	msg := reflect.New(mt.t.Elem()).Interface()
+	if err := mt.codec.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// EncodeMsg returns the id and the body of a registered msg.
+func EncodeMsg(msg interface{}) (ProtoTypeID, []byte, error) {
+	msgTypeLock.RLock()
+	mt, ok := msgIDByType[reflect.TypeOf(msg)]
+	msgTypeLock.RUnlock()
+	if !ok {
+		return 0, nil, ErrMsgUnregistered
+	}
+	b, err := mt.codec.Marshal(msg)
+	return mt.id, b, err
+}
+
+// SendMsg encodes a registered msg and writes it to linker.
+func SendMsg(linker NetLinker, msg interface{}) bool {
+	id, b, err := EncodeMsg(msg)
+	if err != nil {
+		slog.LogWarning("codec", "encode msg [%T] error: %v", msg, err)
+		return false
+	}
+	return linker.WriteMsg(id, b)
+}
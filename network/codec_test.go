@@ -0,0 +1,109 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	testProtoMsg ProtoTypeID = 9001 + iota
+	testJsonMsg
+	testRpcMsg
+)
+
+type testJsonLogin struct {
+	Name  string
+	Level int
+}
+
+var registerTestMsgs sync.Once
+
+// the registry is global, -count reruns share it
+func registerCodecMsgs() {
+	registerTestMsgs.Do(func() {
+		RegisterMsg(testProtoMsg, (*wrapperspb.StringValue)(nil), ProtoCodec)
+		RegisterMsg(testJsonMsg, (*testJsonLogin)(nil), JsonCodec)
+		RegisterMsg(testRpcMsg, (*[]interface{})(nil), RpcCodec)
+	})
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	registerCodecMsgs()
+	for _, d := range []struct {
+		id  ProtoTypeID
+		msg interface{}
+	}{
+		{testProtoMsg, wrapperspb.String("hello")},
+		{testJsonMsg, &testJsonLogin{Name: "einx", Level: 3}},
+		{testRpcMsg, &[]interface{}{"login", 7, []byte("token")}},
+	} {
+		id, b, err := EncodeMsg(d.msg)
+		if err != nil || id != d.id {
+			t.Fatalf("encode %T: id %v %v", d.msg, id, err)
+		}
+		got, err := DecodeMsg(id, b)
+		if err != nil {
+			t.Fatalf("decode %T: %v", d.msg, err)
+		}
+		if pm, ok := d.msg.(proto.Message); ok {
+			if !proto.Equal(got.(proto.Message), pm) {
+				t.Fatalf("decode %T: %v", d.msg, got)
+			}
+		} else if !reflect.DeepEqual(got, d.msg) {
+			t.Fatalf("decode %T: %#v", d.msg, got)
+		}
+		if mid, ok := MsgTypeID(got); !ok || mid != d.id {
+			t.Fatalf("id of %T: %v %v", got, mid, ok)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	registerCodecMsgs()
+	if _, _, err := EncodeMsg(&struct{}{}); !errors.Is(err, ErrMsgUnregistered) {
+		t.Fatalf("encode unregistered: %v", err)
+	}
+	if _, err := DecodeMsg(9999, nil); !errors.Is(err, ErrMsgUnregistered) {
+		t.Fatalf("decode unregistered: %v", err)
+	}
+	if _, err := DecodeMsg(testJsonMsg, []byte("{")); err == nil {
+		t.Fatalf("decode broken json without an error")
+	}
+	if _, err := ProtoCodec.Marshal(&testJsonLogin{}); !errors.Is(err, ErrMsgCodecType) {
+		t.Fatalf("proto marshal of a struct: %v", err)
+	}
+	if _, err := RpcCodec.Marshal([]interface{}{1}); !errors.Is(err, ErrMsgCodecType) {
+		t.Fatalf("rpc marshal of a list value: %v", err)
+	}
+}
+
+func TestRegisterMsgDuplicate(t *testing.T) {
+	registerCodecMsgs()
+	for _, d := range []struct {
+		name string
+		id   ProtoTypeID
+		msg  interface{}
+		want string
+	}{
+		{"id", testJsonMsg, (*struct{ A int })(nil), "register msg id duplicated"},
+		{"type", 9100, (*testJsonLogin)(nil), "register msg type duplicated"},
+		{"value", 9101, testJsonLogin{}, "register msg type must be a pointer"},
+	} {
+		t.Run(d.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != d.want {
+					t.Fatalf("panic %v, want %q", r, d.want)
+				}
+			}()
+			RegisterMsg(d.id, d.msg, JsonCodec)
+		})
+	}
+	if _, ok := MsgTypeID((*struct{ A int })(nil)); ok {
+		t.Fatalf("duplicated id registered its type")
+	}
+}
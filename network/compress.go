@@ -0,0 +1,106 @@
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+)
+
+// packet_flag bits, the low two bits select the compression of msg_data.
+const (
+	PACKET_FLAG_FLATE         = 0x01
+	PACKET_FLAG_ZLIB          = 0x02
+	PACKET_FLAG_COMPRESS_MASK = 0x03
+)
+
+var (
+	ErrMsgCompress = errors.New("msg packet compress flag error")
+)
+
+type packetCompressor struct {
+	buf   bytes.Buffer
+	flate *flate.Writer
+	zlib  *zlib.Writer
+}
+
+// compress returns b when compressing does not shrink it, the result is valid until the next call.
+func (c *packetCompressor) compress(flag uint8, b []byte) ([]byte, uint8, error) {
+	c.buf.Reset()
+	var w interface {
+		io.WriteCloser
+		Reset(io.Writer)
+	}
+	switch flag {
+	case PACKET_FLAG_FLATE:
+		if c.flate == nil {
+			c.flate, _ = flate.NewWriter(nil, flate.DefaultCompression)
+		}
+		w = c.flate
+	case PACKET_FLAG_ZLIB:
+		if c.zlib == nil {
+			c.zlib = zlib.NewWriter(nil)
+		}
+		w = c.zlib
+	default:
+		return nil, 0, ErrMsgCompress
+	}
+
+	w.Reset(&c.buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, 0, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, 0, err
+	}
+	if c.buf.Len() >= len(b) {
+		return b, 0, nil
+	}
+	return c.buf.Bytes(), flag, nil
+}
+
+type packetDecompressor struct {
+	buf   bytes.Buffer
+	src   bytes.Reader
+	flate io.ReadCloser
+	zlib  io.ReadCloser
+}
+
+// decompress refuses bodies inflating beyond max_length, the result is valid until the next call.
+func (d *packetDecompressor) decompress(flag uint8, b []byte, max_length uint32) ([]byte, error) {
+	d.buf.Reset()
+	d.src.Reset(b)
+	var r io.Reader
+	switch flag {
+	case PACKET_FLAG_FLATE:
+		if d.flate == nil {
+			d.flate = flate.NewReader(&d.src)
+		} else if err := d.flate.(flate.Resetter).Reset(&d.src, nil); err != nil {
+			return nil, err
+		}
+		r = d.flate
+	case PACKET_FLAG_ZLIB:
+		if d.zlib == nil {
+			zr, err := zlib.NewReader(&d.src)
+			if err != nil {
+				return nil, err
+			}
+			d.zlib = zr
+		} else if err := d.zlib.(zlib.Resetter).Reset(&d.src, nil); err != nil {
+			return nil, err
+		}
+		r = d.zlib
+	default:
+		return nil, ErrMsgCompress
+	}
+
+	n, err := d.buf.ReadFrom(io.LimitReader(r, int64(max_length)+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(max_length) {
+		return nil, ErrMsgTooLong
+	}
+	return d.buf.Bytes(), nil
+}
@@ -0,0 +1,152 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// PACKET_FLAG_ENCRYPT marks a msg_data sealed with the session key, after compression.
+const PACKET_FLAG_ENCRYPT = 0x04
+
+const (
+	MSG_SEAL_OVERHEAD     = 16
+	MSG_HANDSHAKE_TIMEOUT = 5000 //Millisecond
+)
+
+var (
+	ErrMsgHandshake = errors.New("msg session key handshake error")
+	ErrMsgDecrypt   = errors.New("msg packet decrypt error")
+)
+
+// packetCipher seals msg_data with aes-256-gcm. The nonce is the direction
+// followed by the packet sequence, which both sides count on their own, so
+// replayed, reordered or dropped packets fail to open. The msg type and id
+// are authenticated with the data.
+type packetCipher struct {
+	aead      cipher.AEAD
+	sendNonce [12]byte
+	recvNonce [12]byte
+	sendSeq   uint64
+	recvSeq   uint64
+	sealBuf   []byte
+}
+
+func newPacketCipher(key []byte, outgoing bool) (*packetCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c := &packetCipher{aead: aead}
+	if outgoing {
+		c.recvNonce[3] = 1
+	} else {
+		c.sendNonce[3] = 1
+	}
+	return c, nil
+}
+
+func packetAdditional(ad *[5]byte, msgType byte, msgID ProtoTypeID) []byte {
+	ad[0] = msgType
+	bigEndian.PutUint32(ad[1:], msgID)
+	return ad[:]
+}
+
+// seal returns a slice valid until the next call.
+func (c *packetCipher) seal(msgType byte, msgID ProtoTypeID, b []byte) []byte {
+	var ad [5]byte
+	c.sendSeq++
+	bigEndian.PutUint64(c.sendNonce[4:], c.sendSeq)
+	c.sealBuf = c.aead.Seal(c.sealBuf[:0], c.sendNonce[:], b, packetAdditional(&ad, msgType, msgID))
+	return c.sealBuf
+}
+
+// open decrypts b in place.
+func (c *packetCipher) open(msgType byte, msgID ProtoTypeID, b []byte) ([]byte, error) {
+	var ad [5]byte
+	c.recvSeq++
+	bigEndian.PutUint64(c.recvNonce[4:], c.recvSeq)
+	out, err := c.aead.Open(b[:0], c.recvNonce[:], b, packetAdditional(&ad, msgType, msgID))
+	if err != nil {
+		return nil, ErrMsgDecrypt
+	}
+	return out, nil
+}
+
+// handshake exchanges x25519 public keys in 'K' packets and derives the session key.
+// It hides the traffic from sniffers and defeats replays, use tls when the peer
+// itself must be authenticated.
+func (n *TcpConn) handshake() error {
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(priv); err != nil {
+		return err
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+
+	_ = n.conn.SetDeadline(time.Now().Add(MSG_HANDSHAKE_TIMEOUT * time.Millisecond))
+	defer n.conn.SetDeadline(time.Time{})
+
+	sendKey := func() error {
+		buf := n.writeBuf
+		packPacket(buf, 'K', 0, 0, pub)
+		_, err := n.conn.Write(buf.ReadBuf(buf.Count()))
+		return err
+	}
+
+	// the connecting side sends its key first and the accepting side answers,
+	// both writing first blocks on a conn without write buffer like net.Pipe
+	outgoing := n.connType == Linker_TCP_OutGoing
+	if outgoing {
+		if err := sendKey(); err != nil {
+			return err
+		}
+	}
+	_, peer, err := n.ReadMsgPacket(n.conn)
+	if err != nil {
+		return err
+	}
+	if n.msgPacket.MsgType != 'K' || len(peer) != curve25519.PointSize {
+		return ErrMsgHandshake
+	}
+	if !outgoing {
+		if err := sendKey(); err != nil {
+			return err
+		}
+	}
+	shared, err := curve25519.X25519(priv, peer)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 0, 2*curve25519.PointSize)
+	if outgoing {
+		salt = append(append(salt, pub...), peer...)
+	} else {
+		salt = append(append(salt, peer...), pub...)
+	}
+	key := make([]byte, MSG_KEY_LENGTH)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte("einx session key")), key); err != nil {
+		return err
+	}
+
+	c, err := newPacketCipher(key, outgoing)
+	if err != nil {
+		return err
+	}
+	n.cipher = c
+	return nil
+}
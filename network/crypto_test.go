@@ -0,0 +1,42 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshakePipe(t *testing.T) {
+	opt := newTransportOption()
+	opt.encrypt = true
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	client := newTcpConn(c, nil, Linker_TCP_OutGoing, &opt)
+	server := newTcpConn(s, nil, Linker_TCP_InComming, &opt)
+
+	errs := make(chan error, 2)
+	go func() { errs <- client.handshake() }()
+	go func() { errs <- server.handshake() }()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+		case <-time.After(2 * MSG_HANDSHAKE_TIMEOUT * time.Millisecond):
+			t.Fatal("handshake blocked")
+		}
+	}
+
+	for _, d := range []struct {
+		from, to *TcpConn
+		conn     net.Conn
+	}{{client, server, c}, {server, client, s}} {
+		go d.from.WriteMsgPacket(d.conn, &TransportMsgPack{msgType: 'P', msgID: 3, Buf: []byte("secret")})
+		msgID, body, err := d.to.ReadMsgPacket(d.to.conn)
+		if err != nil || msgID != 3 || string(body) != "secret" {
+			t.Fatalf("sealed msg %v %q %v", msgID, body, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The msg bodies passed to SessionHandler.ServeHandler and ServeRpc are borrowed:
+// they alias the receive buffer of the linker and are only valid until the call
+// returns. Handlers keeping a body, e.g. to RouterMsg it to another module, must
+// copy it, with NewMsgBuffer for a pooled copy, or implement BufferHandler.
+
+// MsgBuffer is a pooled, reference counted msg body. Every owner calls Release
+// once, Retain adds an owner. Modules release a *MsgBuffer routed to them with
+// RouterMsg after the msg handler returns, so a handler keeping it must Retain it.
+type MsgBuffer struct {
+	b     []byte
+	ref   int32
+	class int
+}
+
+var msgBufferClasses = [...]int{512, 2048, 8192, 32768, 131072}
+var msgBufferPools [len(msgBufferClasses)]sync.Pool
+
+func getMsgBuffer(size int) *MsgBuffer {
+	for i, c := range msgBufferClasses {
+		if size > c {
+			continue
+		}
+		if v := msgBufferPools[i].Get(); v != nil {
+			mb := v.(*MsgBuffer)
+			mb.b = mb.b[:size]
+			mb.ref = 1
+			return mb
+		}
+		return &MsgBuffer{b: make([]byte, size, c), ref: 1, class: i}
+	}
+	return &MsgBuffer{b: make([]byte, size), ref: 1, class: -1}
+}
+
+// NewMsgBuffer returns a pooled copy of b owned by the caller.
+func NewMsgBuffer(b []byte) *MsgBuffer {
+	mb := getMsgBuffer(len(b))
+	copy(mb.b, b)
+	return mb
+}
+
+func (m *MsgBuffer) Bytes() []byte {
+	return m.b
+}
+
+func (m *MsgBuffer) Len() int {
+	return len(m.b)
+}
+
+func (m *MsgBuffer) Retain() *MsgBuffer {
+	atomic.AddInt32(&m.ref, 1)
+	return m
+}
+
+func (m *MsgBuffer) Release() {
+	ref := atomic.AddInt32(&m.ref, -1)
+	if ref > 0 {
+		return
+	}
+	if ref < 0 {
+		panic("network msg buffer released too many times")
+	}
+	if m.class >= 0 {
+		m.b = m.b[:0]
+		msgBufferPools[m.class].Put(m)
+	}
+}
+
+func (m *MsgBuffer) setLen(n int) {
+	m.b = m.b[:n]
+}
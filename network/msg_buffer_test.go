@@ -0,0 +1,84 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// keepHandler keeps the buffers and hands them to the test goroutine.
+type keepHandler struct {
+	kept chan *MsgBuffer
+}
+
+func (h *keepHandler) ServeHandler(Agent, ProtoTypeID, []byte) {}
+func (h *keepHandler) ServeRpc(Agent, ProtoTypeID, []byte)     {}
+
+func (h *keepHandler) ServeMsgBuffer(a Agent, msgID ProtoTypeID, mb *MsgBuffer) {
+	h.kept <- mb
+}
+
+func (h *keepHandler) ServeRpcBuffer(a Agent, msgID ProtoTypeID, mb *MsgBuffer) {
+	h.kept <- mb
+}
+
+// TestMsgBufferKept reads the next msgs while the handler still holds the
+// previous buffers, run it with -race.
+func TestMsgBufferKept(t *testing.T) {
+	const count = 200
+	opt := newTransportOption()
+	r, w := net.Pipe()
+	sender := newTestConn(w, &opt)
+	go func() {
+		for i := 0; i < count; i++ {
+			body := []byte(fmt.Sprintf("msg %d %s", i, bytes.Repeat([]byte{byte(i)}, i)))
+			sender.WriteMsgPacket(w, &TransportMsgPack{msgType: 'P', msgID: ProtoTypeID(i), Buf: body})
+		}
+		w.Close()
+	}()
+
+	h := &keepHandler{kept: make(chan *MsgBuffer, 8)}
+	n := newTcpConn(r, h, Linker_TCP_OutGoing, &opt)
+	done := make(chan struct{})
+	go func() {
+		n.Recv()
+		close(h.kept)
+		close(done)
+	}()
+
+	i := 0
+	for mb := range h.kept {
+		want := []byte(fmt.Sprintf("msg %d %s", i, bytes.Repeat([]byte{byte(i)}, i)))
+		if !bytes.Equal(mb.Bytes(), want) {
+			t.Errorf("msg %d: %q", i, mb.Bytes())
+		}
+		mb.Release()
+		i++
+	}
+	<-done
+	r.Close()
+	if i != count {
+		t.Fatalf("got %d msgs, want %d", i, count)
+	}
+}
+
+func TestMsgBufferRelease(t *testing.T) {
+	mb := NewMsgBuffer([]byte("body"))
+	mb.Retain()
+	mb.Release()
+	if ref := atomic.LoadInt32(&mb.ref); ref != 1 || string(mb.Bytes()) != "body" {
+		t.Fatalf("released with an owner left: ref %d %q", ref, mb.Bytes())
+	}
+	mb.Release()
+	if ref := atomic.LoadInt32(&mb.ref); ref != 0 || mb.Len() != 0 {
+		t.Fatalf("not handed back to the pool: ref %d len %d", ref, mb.Len())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("released twice without a panic")
+		}
+	}()
+	mb.Release()
+}
@@ -1,7 +1,10 @@
 package network
 
 import (
+	"crypto/x509"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/jslyzt/einx/agent"
 	"github.com/jslyzt/einx/component"
@@ -43,6 +46,8 @@ type ITcpClientMgr interface {
 	GetID() ComponentID
 	GetType() ComponentType
 	Connect(addr string, user_type interface{})
+	ConnectLink(name string, addr string, user_type interface{})
+	CloseLink(name string)
 }
 
 type ConnType uint16
@@ -128,8 +133,7 @@ func (m *TransportMultiple) Done() bool {
 	if m.trans.IsClosed() {
 		return false
 	}
-	m.trans.doPushWrite(m)
-	return true
+	return m.trans.doPushWrite(m)
 }
 
 func (b *TransportMultiple) reset() {
@@ -144,15 +148,21 @@ func (b *TransportMultiple) reset() {
 const (
 	COMPONENT_TYPE_TCP_SERVER = component.COMPONENT_TYPE_TCP_SERVER
 	COMPONENT_TYPE_TCP_CLIENT = component.COMPONENT_TYPE_TCP_CLIENT
+	COMPONENT_TYPE_WS_SERVER  = component.COMPONENT_TYPE_WS_SERVER
+	COMPONENT_TYPE_WS_CLIENT  = component.COMPONENT_TYPE_WS_CLIENT
+	COMPONENT_TYPE_UDP_SERVER = component.COMPONENT_TYPE_UDP_SERVER
+	COMPONENT_TYPE_UDP_CLIENT = component.COMPONENT_TYPE_UDP_CLIENT
 )
 
 type NetLinker interface {
 	GetID() AgentID
 	Close()
 	RemoteAddr() net.Addr
+	PeerCertificate() *x509.Certificate
 	WriteMsg(ProtoTypeID, []byte) bool
 	RpcCall(ProtoTypeID, []byte) bool
 	MultipleMsg() ITranMsgMultiple
+	QueueDepth() (msgs int, bytes int)
 	GetUserType() interface{}
 	SetUserType(interface{})
 	Run() error
@@ -163,11 +173,55 @@ type SessionMgr interface {
 	OnLinkerClosed(AgentID, Agent, error)
 }
 
+// ReconnectMgr is optionally implemented by a SessionMgr to observe links kept by ConnectLink.
+type ReconnectMgr interface {
+	OnLinkerReconnecting(name string, user_type interface{}, attempt int, err error)
+	OnLinkerReconnected(AgentID, Agent)
+}
+
+// DrainMgr is optionally implemented by a SessionMgr to send the last msgs before a linker is drained.
+type DrainMgr interface {
+	OnLinkerDraining(AgentID, Agent)
+}
+
+type Drainer interface {
+	Drain(deadline time.Time)
+}
+
+// SessionHandler gets the msg bodies borrowed, see MsgBuffer.
 type SessionHandler interface {
 	ServeHandler(Agent, ProtoTypeID, []byte)
 	ServeRpc(Agent, ProtoTypeID, []byte)
 }
 
+// BufferHandler is optionally implemented by a SessionHandler to own the msg bodies,
+// it is called instead of ServeHandler and ServeRpc and must Release the buffers.
+type BufferHandler interface {
+	ServeMsgBuffer(Agent, ProtoTypeID, *MsgBuffer)
+	ServeRpcBuffer(Agent, ProtoTypeID, *MsgBuffer)
+}
+
 func Run() {
 	go pingMgr.Run()
 }
+
+type serverDrainer interface {
+	Drain(timeout int64)
+}
+
+var tcp_servers sync.Map
+
+// Drain stops accepting on every tcp and websocket server and drains their linkers,
+// it returns when all of them are closed or the timeout expires.
+func Drain(timeout int64) {
+	var wait sync.WaitGroup
+	tcp_servers.Range(func(k interface{}, v interface{}) bool {
+		wait.Add(1)
+		go func(mgr serverDrainer) {
+			defer wait.Done()
+			mgr.Drain(timeout)
+		}(v.(serverDrainer))
+		return true
+	})
+	wait.Wait()
+}
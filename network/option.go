@@ -1,18 +1,36 @@
 package network
 
+import (
+	"crypto/tls"
+	"net/http"
+)
+
 type TransportOption struct {
 	msg_max_length uint32
 	msg_max_count  int32 //max msg count per seconds
 	ping_time      int64
 	enable_ping    bool
+
+	compress_flag      uint8
+	compress_threshold int
+	encrypt            bool
+	limit_action       int
+	write_max_msgs     int64
+	write_max_bytes    int64
+	write_policy       int
+	write_batch_count  int
+	write_batch_bytes  int
+	write_flush_delay  int64 //Millisecond
 }
 
 func newTransportOption() TransportOption {
 	o := TransportOption{
 		msg_max_length: MSG_MAX_BODY_LENGTH,
-		msg_max_count:  MSG_DEFAULT_COUNT,
 		ping_time:      5 * 1000,
 		enable_ping:    true,
+
+		write_batch_count: MSG_WRITE_BATCH_COUNT,
+		write_batch_bytes: MSG_WRITE_BATCH_BYTES,
 	}
 	return o
 }
@@ -31,6 +49,14 @@ func Name(name string) Option {
 			v.name = name
 		case *TcpClientMgr:
 			v.name = name
+		case *WsServerMgr:
+			v.name = name
+		case *WsClientMgr:
+			v.name = name
+		case *UdpServerMgr:
+			v.name = name
+		case *UdpClientMgr:
+			v.name = name
 		default:
 			panic("option network name unknown type")
 		}
@@ -45,6 +71,14 @@ func Module(m EventReceiver) Option {
 			v.module = m
 		case *TcpClientMgr:
 			v.module = m
+		case *WsServerMgr:
+			v.module = m
+		case *WsClientMgr:
+			v.module = m
+		case *UdpServerMgr:
+			v.module = m
+		case *UdpClientMgr:
+			v.module = m
 		default:
 			panic("option network module unknown type")
 		}
@@ -57,6 +91,10 @@ func ListenAddr(addr string) Option {
 		switch v := t.(type) {
 		case *TcpServerMgr:
 			v.addr = addr
+		case *WsServerMgr:
+			v.addr = addr
+		case *UdpServerMgr:
+			v.addr = addr
 		default:
 			panic("option network listen addr unknown type")
 		}
@@ -71,12 +109,23 @@ func ServeHandler(serve_handler SessionHandler) Option {
 			v.agentHandler = serve_handler
 		case *TcpClientMgr:
 			v.agent_handler = serve_handler
+		case *WsServerMgr:
+			v.agentHandler = serve_handler
+		case *WsClientMgr:
+			v.agent_handler = serve_handler
+		case *UdpServerMgr:
+			v.agentHandler = serve_handler
+		case *UdpClientMgr:
+			v.agent_handler = serve_handler
 		default:
 			panic("option network serve handler unknown type")
 		}
 	}
 }
 
+// TransportMaxCount limits the msgs received by a linker per second, bursts up to
+// MSG_COUNT_CHECK_TIME worth of msgs are allowed. The limit is off by default,
+// 0 disables it, e.g. TransportMaxCount(MSG_DEFAULT_COUNT) on a server.
 func TransportMaxCount(c int) Option {
 	return func(args ...interface{}) {
 		if t, ok := args[0].(OptionMgr); ok {
@@ -87,6 +136,55 @@ func TransportMaxCount(c int) Option {
 	}
 }
 
+// TransportLimitAction selects what happens to the msgs over TransportMaxCount,
+// LIMIT_ACTION_DELAY by default.
+func TransportLimitAction(action int) Option {
+	return func(args ...interface{}) {
+		if action < LIMIT_ACTION_DELAY || action > LIMIT_ACTION_CLOSE {
+			panic("option network transport limit action unknown action")
+		}
+		if t, ok := args[0].(OptionMgr); ok {
+			t.GetOption().limit_action = action
+		} else {
+			panic("option network transport limit action unknown type")
+		}
+	}
+}
+
+// TransportWriteLimit sets the high water mark of the write queue of each linker
+// in msgs and bytes (0 for no limit) and the policy applied over it.
+func TransportWriteLimit(max_msgs int, max_bytes int, policy int) Option {
+	return func(args ...interface{}) {
+		if policy < WRITE_POLICY_BLOCK || policy > WRITE_POLICY_DISCONNECT {
+			panic("option network transport write limit unknown policy")
+		}
+		if t, ok := args[0].(OptionMgr); ok {
+			t.GetOption().write_max_msgs = int64(max_msgs)
+			t.GetOption().write_max_bytes = int64(max_bytes)
+			t.GetOption().write_policy = policy
+		} else {
+			panic("option network transport write limit unknown type")
+		}
+	}
+}
+
+// TransportWriteBatch sets how many msgs and bytes a tcp linker coalesces into one
+// socket write, and how long it waits for more msgs when fewer than max_count are queued.
+func TransportWriteBatch(max_count int, max_bytes int, flush_delay int64) Option {
+	return func(args ...interface{}) {
+		if max_count <= 0 || max_bytes <= 0 {
+			panic("option network transport write batch must be positive")
+		}
+		if t, ok := args[0].(OptionMgr); ok {
+			t.GetOption().write_batch_count = max_count
+			t.GetOption().write_batch_bytes = max_bytes
+			t.GetOption().write_flush_delay = flush_delay
+		} else {
+			panic("option network transport write batch unknown type")
+		}
+	}
+}
+
 func TransportMaxLength(c int) Option {
 	return func(args ...interface{}) {
 		if t, ok := args[0].(OptionMgr); ok {
@@ -107,3 +205,156 @@ func TransportKeepAlive(e bool, c int64) Option {
 		}
 	}
 }
+
+// TransportCompress compresses the msgs sent with at least threshold bytes,
+// flag is PACKET_FLAG_FLATE or PACKET_FLAG_ZLIB, 0 disables it.
+// Compressed msgs are always accepted whatever the option of the receiver.
+func TransportCompress(flag uint8, threshold int) Option {
+	return func(args ...interface{}) {
+		if flag & ^uint8(PACKET_FLAG_COMPRESS_MASK) != 0 || flag == PACKET_FLAG_COMPRESS_MASK {
+			panic("option network transport compress unknown flag")
+		}
+		if t, ok := args[0].(OptionMgr); ok {
+			t.GetOption().compress_flag = flag
+			t.GetOption().compress_threshold = threshold
+		} else {
+			panic("option network transport compress unknown type")
+		}
+	}
+}
+
+// TransportEncrypt derives a session key when a linker is established and encrypts
+// every 'P' and 'R' packet with it, both sides must enable it.
+func TransportEncrypt(e bool) Option {
+	return func(args ...interface{}) {
+		if t, ok := args[0].(OptionMgr); ok {
+			t.GetOption().encrypt = e
+		} else {
+			panic("option network transport encrypt unknown type")
+		}
+	}
+}
+
+func Reconnect(min_delay int64, max_delay int64, jitter float64, max_attempts int) Option {
+	return func(args ...interface{}) {
+		t := args[0]
+		switch v := t.(type) {
+		case *TcpClientMgr:
+			v.reconnect.min_delay = min_delay
+			v.reconnect.max_delay = max_delay
+			v.reconnect.jitter = jitter
+			v.reconnect.max_attempts = max_attempts
+		default:
+			panic("option network reconnect unknown type")
+		}
+	}
+}
+
+func DialTimeout(timeout int64) Option {
+	return func(args ...interface{}) {
+		t := args[0]
+		switch v := t.(type) {
+		case *TcpClientMgr:
+			v.dial_timeout = timeout
+		case *WsClientMgr:
+			v.dial_timeout = timeout
+		default:
+			panic("option network dial timeout unknown type")
+		}
+	}
+}
+
+// TLSConfig sets the tls config of a server or client, the certificates and cas
+// given by TLSCertFile and TLSCAFile are kept whatever the order of the options.
+func TLSConfig(cfg *tls.Config) Option {
+	return func(args ...interface{}) {
+		p := tlsConfigRef(args[0])
+		*p = mergeTLSConfig(*p, cfg)
+	}
+}
+
+// TLSCertFile loads the certificate presented by a server, or by a client for mutual tls.
+func TLSCertFile(certFile string, keyFile string) Option {
+	return func(args ...interface{}) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			panic("option network tls cert file: " + err.Error())
+		}
+		cfg := tlsConfigOf(args[0])
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// TLSCAFile makes a server require client certificates signed by the ca (mutual tls),
+// and a client verify the server certificate against it.
+func TLSCAFile(caFile string) Option {
+	return func(args ...interface{}) {
+		pool := loadCertPool(caFile)
+		cfg := tlsConfigOf(args[0])
+		switch args[0].(type) {
+		case *TcpServerMgr, *WsServerMgr:
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			cfg.RootCAs = pool
+		}
+	}
+}
+
+func WsPath(path string) Option {
+	return func(args ...interface{}) {
+		t := args[0]
+		switch v := t.(type) {
+		case *WsServerMgr:
+			v.path = path
+		default:
+			panic("option network ws path unknown type")
+		}
+	}
+}
+
+// WsCheckOrigin filters the upgrade requests by their origin. By default a request
+// with an Origin header is only accepted from the host it is sent to, browser
+// pages served by other hosts need a check accepting them.
+func WsCheckOrigin(f func(r *http.Request) bool) Option {
+	return func(args ...interface{}) {
+		t := args[0]
+		switch v := t.(type) {
+		case *WsServerMgr:
+			v.upgrader.CheckOrigin = f
+		default:
+			panic("option network ws check origin unknown type")
+		}
+	}
+}
+
+// KcpNoDelay sets the arq mode of reliable udp sessions: nodelay, the update interval
+// in milliseconds, the fast resend ack count (0 disables it) and no congestion control.
+func KcpNoDelay(nodelay bool, interval int, resend int, nc bool) Option {
+	return func(args ...interface{}) {
+		o := kcpOptionOf(args[0])
+		o.nodelay, o.nc = 0, 0
+		if nodelay {
+			o.nodelay = 1
+		}
+		if nc {
+			o.nc = 1
+		}
+		o.interval = interval
+		o.resend = resend
+	}
+}
+
+func KcpWindow(snd_wnd int, rcv_wnd int) Option {
+	return func(args ...interface{}) {
+		o := kcpOptionOf(args[0])
+		o.snd_wnd = snd_wnd
+		o.rcv_wnd = rcv_wnd
+	}
+}
+
+func KcpMtu(mtu int) Option {
+	return func(args ...interface{}) {
+		kcpOptionOf(args[0]).mtu = mtu
+	}
+}
@@ -0,0 +1,119 @@
+package network
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// actions taken on a packet received while the rate limiter of its linker is empty
+const (
+	LIMIT_ACTION_DELAY = iota // stop reading until a token is refilled
+	LIMIT_ACTION_DROP         // drop the packet
+	LIMIT_ACTION_CLOSE        // close the linker with ErrMsgRateLimit
+)
+
+var (
+	ErrMsgRateLimit = errors.New("msg rate limit exceeded")
+)
+
+type RateStats struct {
+	Recv    uint64
+	Dropped uint64
+	Delayed uint64
+	Closed  uint64
+}
+
+var rateStats RateStats
+
+// RateLimitStats returns the counters summed over every linker since the start.
+func RateLimitStats() RateStats {
+	return RateStats{
+		Recv:    atomic.LoadUint64(&rateStats.Recv),
+		Dropped: atomic.LoadUint64(&rateStats.Dropped),
+		Delayed: atomic.LoadUint64(&rateStats.Delayed),
+		Closed:  atomic.LoadUint64(&rateStats.Closed),
+	}
+}
+
+// rateLimiter is a token bucket refilled with msg_max_count tokens per second,
+// holding at most the tokens of MSG_COUNT_CHECK_TIME. Tokens are counted in
+// thousandths so that the refill stays exact with integer math.
+type rateLimiter struct {
+	recvCheckTime int64
+	msgRecvCount  int64
+	stats         RateStats
+}
+
+func newRateLimiter(opt *TransportOption, nowTick int64) rateLimiter {
+	return rateLimiter{
+		recvCheckTime: nowTick,
+		msgRecvCount:  int64(opt.msg_max_count) * MSG_COUNT_CHECK_TIME,
+	}
+}
+
+// take consumes a token and returns 0, or the milliseconds until one is refilled.
+func (l *rateLimiter) take(opt *TransportOption, nowTick int64) int64 {
+	rate := int64(opt.msg_max_count)
+	if rate <= 0 {
+		return 0
+	}
+	tokens := l.msgRecvCount + (nowTick-l.recvCheckTime)*rate
+	if capacity := rate * MSG_COUNT_CHECK_TIME; tokens > capacity {
+		tokens = capacity
+	}
+	l.recvCheckTime = nowTick
+	if tokens >= 1000 {
+		l.msgRecvCount = tokens - 1000
+		return 0
+	}
+	l.msgRecvCount = tokens
+	return (1000 - tokens + rate - 1) / rate
+}
+
+// allow applies the limit action to a received packet and tells whether to
+// serve it, err is ErrMsgRateLimit when the linker must be closed.
+func (l *rateLimiter) allow(opt *TransportOption, nowTick int64) (bool, error) {
+	atomic.AddUint64(&l.stats.Recv, 1)
+	atomic.AddUint64(&rateStats.Recv, 1)
+
+	wait := l.take(opt, nowTick)
+	if wait == 0 {
+		return true, nil
+	}
+	switch opt.limit_action {
+	case LIMIT_ACTION_DROP:
+		atomic.AddUint64(&l.stats.Dropped, 1)
+		atomic.AddUint64(&rateStats.Dropped, 1)
+		return false, nil
+	case LIMIT_ACTION_CLOSE:
+		atomic.AddUint64(&l.stats.Closed, 1)
+		atomic.AddUint64(&rateStats.Closed, 1)
+		return false, ErrMsgRateLimit
+	default:
+		atomic.AddUint64(&l.stats.Delayed, 1)
+		atomic.AddUint64(&rateStats.Delayed, 1)
+		for wait > 0 {
+			time.Sleep(time.Duration(wait) * time.Millisecond)
+			wait = l.take(opt, UnixTS())
+		}
+		return true, nil
+	}
+}
+
+func (l *rateLimiter) rateStats() RateStats {
+	return RateStats{
+		Recv:    atomic.LoadUint64(&l.stats.Recv),
+		Dropped: atomic.LoadUint64(&l.stats.Dropped),
+		Delayed: atomic.LoadUint64(&l.stats.Delayed),
+		Closed:  atomic.LoadUint64(&l.stats.Closed),
+	}
+}
+
+func (n *TcpConn) RateStats() RateStats {
+	return n.limiter.rateStats()
+}
+
+func (n *WsConn) RateStats() RateStats {
+	return n.limiter.rateStats()
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func floodPings(t *testing.T, action int, count int) *TcpConn {
+	opt := newTransportOption()
+	opt.msg_max_count = 10 // a burst of 30 msgs
+	opt.limit_action = action
+	opt.enable_ping = false
+	r, w := net.Pipe()
+	defer r.Close()
+
+	packets := make([][]byte, count)
+	for i := range packets {
+		packets[i] = rawPacket(MSG_MAGIC|MSG_VERSION, 'T', 0, 0, nil)
+	}
+	pipeWrite(w, packets...)
+	n := newTcpConn(r, nil, Linker_TCP_InComming, &opt)
+	n.Recv()
+	return n
+}
+
+func TestRateLimitPingFlood(t *testing.T) {
+	n := floodPings(t, LIMIT_ACTION_CLOSE, 100)
+	if err := n.getCloseErr(); !errors.Is(err, ErrMsgRateLimit) {
+		t.Fatalf("close error %v, want ErrMsgRateLimit", err)
+	}
+	if st := n.RateStats(); st.Closed != 1 || st.Recv > 32 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	n = floodPings(t, LIMIT_ACTION_DROP, 100)
+	if st := n.RateStats(); st.Recv != 100 || st.Dropped < 60 {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+func TestPingAnswerInterval(t *testing.T) {
+	opt := newTransportOption()
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	n := newTcpConn(s, nil, Linker_TCP_InComming, &opt)
+
+	now := UnixTS()
+	for i := 0; i < 10; i++ {
+		n.DoPong(now)
+	}
+	if queued := n.backlog.queue.Count(); queued != 1 {
+		t.Fatalf("answered %d pings, want 1", queued)
+	}
+	n.DoPong(now + opt.ping_time/2)
+	if queued := n.backlog.queue.Count(); queued != 2 {
+		t.Fatalf("answered %d pings after half ping_time, want 2", queued)
+	}
+}
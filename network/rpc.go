@@ -1,198 +1,592 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"reflect"
+	"strings"
+)
+
+// --------------------------------------------------------------------------------------
+// |                      rpc value format, version RPC_FORMAT_VERSION                  |
+// --------------------------------------------------------------------------------------
+// an encoded value starts with the version byte, then every value starts with
+// a tag byte, lengths are uint32 little endian:
+//
+//	'z' nil, 't' true, 'f' false
+//	's' length string, '!' length []byte
+//	'd' float64, 'e' float32: the ieee 754 bits little endian
+//	the integers are the zigzag varint of the value as int64, at most 10 bytes:
+//	'i' int, 'u' uint, 'b' int8, 'c' uint8, 'w' int16, 'm' uint16,
+//	'q' int32, 'p' uint32, 'l' int64, 'n' uint64
+//	'{' value ... '}' list, decoded as []interface{}
+//	'[' key value ... ']' map, decoded as map[interface{}]interface{}
+//
+// Slices and arrays are lists, maps are maps and structs are maps keyed by the
+// exported field names or their `rpc:"name"` tag, `rpc:"-"` skips a field.
+// Pointers are their element or nil. The lua runtime shares the format.
+// A value starting with a tag is the unversioned format of the older nodes,
+// where a float64 is 'd' '2' and the ieee 754 bits.
+const (
+	RPC_FORMAT_VERSION = 1
+	RPC_MAX_DEPTH      = 64
+)
 
-	"github.com/jslyzt/einx/slog"
+var (
+	ErrRpcVersion   = errors.New("rpc value version unknown")
+	ErrRpcType      = errors.New("rpc value type not supported")
+	ErrRpcTag       = errors.New("rpc value tag unknown")
+	ErrRpcTruncated = errors.New("rpc value truncated")
+	ErrRpcVarint    = errors.New("rpc value varint overflow")
+	ErrRpcDepth     = errors.New("rpc value nested too deep")
+	ErrRpcMapKey    = errors.New("rpc value map key not comparable")
+	ErrRpcAssign    = errors.New("rpc value not assignable")
 )
 
-func RpcMarshal(b []byte, val interface{}) []byte {
-	var buffer []byte = nil
+// RpcMarshal appends val to b as RpcEncode does.
+func RpcMarshal(b []byte, val interface{}) ([]byte, error) {
+	return RpcEncode(b, val)
+}
+
+// RpcUnMarshal returns the first value of b as RpcDecode does.
+func RpcUnMarshal(b []byte) (interface{}, []byte, error) {
+	return RpcDecode(b)
+}
+
+// RpcEncode appends the version byte and val to b, b is returned unchanged
+// on an error.
+func RpcEncode(b []byte, val interface{}) ([]byte, error) {
+	n := len(b)
+	buffer, err := rpcEncode(append(b, RPC_FORMAT_VERSION), val, 0)
+	if err != nil {
+		return buffer[:n], err
+	}
+	return buffer, nil
+}
+
+func rpcEncode(b []byte, val interface{}, depth int) ([]byte, error) {
+	if depth > RPC_MAX_DEPTH {
+		return b, ErrRpcDepth
+	}
 	switch v := val.(type) {
 	case nil:
-		buffer = append(b, 'z')
+		return append(b, 'z'), nil
 	case bool:
 		if v {
-			buffer = append(b, 't')
-		} else {
-			buffer = append(b, 'f')
+			return append(b, 't'), nil
 		}
+		return append(b, 'f'), nil
 	case string:
-		slen := uint32(len(v))
-		buffer = append(b, 's', byte(slen), byte(slen>>8), byte(slen>>16), byte(slen>>24))
-		buffer = append(buffer, v...)
-	case float32, float64:
-		n := math.Float64bits(v.(float64))
-		buffer = append(b, 'd', '2', byte(n), byte(n>>8), byte(n>>16), byte(n>>24), byte(n>>32), byte(n>>40), byte(n>>48), byte(n>>56))
-	case int, int16, uint16, int32, int64, uint32, uint64:
-		I64i, Itype := convertInteger(v)
-		buffer = append(b, Itype)
-		ux := uint64(I64i) << 1
-		if I64i < 0 {
-			ux = ^ux
-		}
-		for ux >= 0x80 {
-			buffer = append(buffer, byte(ux)|0x80)
-			ux >>= 7
-		}
-		buffer = append(buffer, byte(ux))
+		return append(appendLength(b, 's', len(v)), v...), nil
 	case []byte:
-		slen := uint32(len(v))
-		buffer = append(b, '!', byte(slen), byte(slen>>8), byte(slen>>16), byte(slen>>24))
-		buffer = append(buffer, v...)
+		return append(appendLength(b, '!', len(v)), v...), nil
+	case float64:
+		n := math.Float64bits(v)
+		return append(b, 'd', byte(n), byte(n>>8), byte(n>>16), byte(n>>24), byte(n>>32), byte(n>>40), byte(n>>48), byte(n>>56)), nil
+	case float32:
+		n := math.Float32bits(v)
+		return append(b, 'e', byte(n), byte(n>>8), byte(n>>16), byte(n>>24)), nil
+	case int:
+		return appendVarint(b, 'i', int64(v)), nil
+	case uint:
+		return appendVarint(b, 'u', int64(v)), nil
+	case int8:
+		return appendVarint(b, 'b', int64(v)), nil
+	case uint8:
+		return appendVarint(b, 'c', int64(v)), nil
+	case int16:
+		return appendVarint(b, 'w', int64(v)), nil
+	case uint16:
+		return appendVarint(b, 'm', int64(v)), nil
+	case int32:
+		return appendVarint(b, 'q', int64(v)), nil
+	case uint32:
+		return appendVarint(b, 'p', int64(v)), nil
+	case int64:
+		return appendVarint(b, 'l', v), nil
+	case uint64:
+		return appendVarint(b, 'n', int64(v)), nil
+	case []interface{}:
+		var err error
+		b = append(b, '{')
+		for _, m := range v {
+			if b, err = rpcEncode(b, m, depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, '}'), nil
 	case map[string]interface{}:
-		buffer = append(b, '[')
+		var err error
+		b = append(b, '[')
 		for key, value := range v {
-			buffer = RpcMarshal(RpcMarshal(buffer, key), value)
+			b = append(appendLength(b, 's', len(key)), key...)
+			if b, err = rpcEncode(b, value, depth+1); err != nil {
+				return b, err
+			}
 		}
-		buffer = append(buffer, ']')
-	case []interface{}:
-		buffer = append(b, '{')
-		for _, m := range v {
-			buffer = RpcMarshal(buffer, m)
+		return append(b, ']'), nil
+	case map[interface{}]interface{}:
+		var err error
+		b = append(b, '[')
+		for key, value := range v {
+			if b, err = rpcEncode(b, key, depth+1); err != nil {
+				return b, err
+			}
+			if b, err = rpcEncode(b, value, depth+1); err != nil {
+				return b, err
+			}
 		}
-		buffer = append(buffer, '}')
+		return append(b, ']'), nil
 	default:
-		panic("unsopported rpc type")
+		return rpcEncodeValue(b, reflect.ValueOf(val), depth)
 	}
-	return buffer
 }
 
-func convertInteger(val interface{}) (int64, byte) {
-	switch v := val.(type) {
-	case int:
-		return int64(v), 'i'
-	case int16:
-		return int64(v), 'w'
-	case uint16:
-		return int64(v), 'm'
-	case int32:
-		return int64(v), 'q'
-	case uint32:
-		return int64(v), 'p'
-	case int64:
-		return v, 'l'
-	case uint64:
-		return int64(v), 'n'
+func rpcEncodeValue(b []byte, v reflect.Value, depth int) ([]byte, error) {
+	var err error
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 'z'), nil
+		}
+		return rpcEncode(b, v.Elem().Interface(), depth+1)
+	case reflect.Bool:
+		return rpcEncode(b, v.Bool(), depth)
+	case reflect.String:
+		return rpcEncode(b, v.String(), depth)
+	case reflect.Float32:
+		return rpcEncode(b, float32(v.Float()), depth)
+	case reflect.Float64:
+		return rpcEncode(b, v.Float(), depth)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rpcEncode(b, v.Convert(kindTypes[v.Kind()]).Interface(), depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return rpcEncode(b, v.Bytes(), depth)
+		}
+		b = append(b, '{')
+		for i := 0; i < v.Len(); i++ {
+			if b, err = rpcEncodeValue(b, v.Index(i), depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, '}'), nil
+	case reflect.Map:
+		b = append(b, '[')
+		iter := v.MapRange()
+		for iter.Next() {
+			if b, err = rpcEncodeValue(b, iter.Key(), depth+1); err != nil {
+				return b, err
+			}
+			if b, err = rpcEncodeValue(b, iter.Value(), depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case reflect.Struct:
+		b = append(b, '[')
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := rpcFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			b = append(appendLength(b, 's', len(name)), name...)
+			if b, err = rpcEncodeValue(b, v.Field(i), depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
 	default:
-		panic("unknown integer type.")
+		return b, ErrRpcType
 	}
 }
 
-func makeInteger(x int64, t byte) interface{} {
-	switch t {
-	case 'i':
-		return int(x)
-	case 'w':
-		return int16(x)
-	case 'm':
-		return uint16(x)
-	case 'q':
-		return int32(x)
-	case 'p':
-		return uint32(x)
-	case 'l':
-		return x
-	case 'n':
-		return uint64(x)
+var kindTypes = map[reflect.Kind]reflect.Type{
+	reflect.Int:    reflect.TypeOf(int(0)),
+	reflect.Int8:   reflect.TypeOf(int8(0)),
+	reflect.Int16:  reflect.TypeOf(int16(0)),
+	reflect.Int32:  reflect.TypeOf(int32(0)),
+	reflect.Int64:  reflect.TypeOf(int64(0)),
+	reflect.Uint:   reflect.TypeOf(uint(0)),
+	reflect.Uint8:  reflect.TypeOf(uint8(0)),
+	reflect.Uint16: reflect.TypeOf(uint16(0)),
+	reflect.Uint32: reflect.TypeOf(uint32(0)),
+	reflect.Uint64: reflect.TypeOf(uint64(0)),
+}
+
+func rpcFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("rpc")
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+func appendLength(b []byte, tag byte, n int) []byte {
+	return append(b, tag, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+func appendVarint(b []byte, tag byte, x int64) []byte {
+	b = append(b, tag)
+	ux := uint64(x) << 1
+	if x < 0 {
+		ux = ^ux
+	}
+	for ux >= 0x80 {
+		b = append(b, byte(ux)|0x80)
+		ux >>= 7
+	}
+	return append(b, byte(ux))
+}
+
+// RpcDecode returns the first value of b and the bytes after it.
+func RpcDecode(b []byte) (interface{}, []byte, error) {
+	if len(b) < 1 {
+		return nil, b, ErrRpcTruncated
+	}
+	switch v := b[0]; {
+	case v == RPC_FORMAT_VERSION:
+		val, rest, err := rpcDecode(b[1:], 0, false)
+		if err != nil {
+			return nil, b, err
+		}
+		return val, rest, nil
+	case v < ' ': // the tags are printable
+		return nil, b, fmt.Errorf("%w: %d", ErrRpcVersion, v)
 	default:
-		panic(fmt.Sprintf("unknown integer type [%v]", t))
+		return rpcDecode(b, 0, true)
 	}
 }
 
-func RpcUnMarshal(b []byte) (interface{}, []byte) {
+func rpcDecode(b []byte, depth int, legacy bool) (interface{}, []byte, error) {
 	if len(b) < 1 {
-		return nil, b
+		return nil, b, ErrRpcTruncated
+	}
+	if depth > RPC_MAX_DEPTH {
+		return nil, b, ErrRpcDepth
 	}
 	t := b[0]
 	switch t {
 	case 'z':
-		return nil, b[1:]
+		return nil, b[1:], nil
 	case 't':
-		return true, b[1:]
+		return true, b[1:], nil
 	case 'f':
-		return false, b[1:]
-	case 's':
+		return false, b[1:], nil
+	case 's', '!':
 		if len(b) < 5 {
-			slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal string")
-			return nil, b
+			return nil, b, ErrRpcTruncated
 		}
-		slen := uint32(b[1]) | uint32(b[2])<<8 | uint32(b[3])<<16 | uint32(b[4])<<24
-		return string(b[5 : 5+slen]), b[5+slen:]
-	case '!':
-		if len(b) < 5 {
-			slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal []byte")
-			return nil, b
+		slen := uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16 | uint64(b[4])<<24
+		if slen > uint64(len(b)-5) {
+			return nil, b, ErrRpcTruncated
+		}
+		data := b[5 : 5+slen]
+		if t == 's' {
+			return string(data), b[5+slen:], nil
 		}
-		slen := uint32(b[1]) | uint32(b[2])<<8 | uint32(b[3])<<16 | uint32(b[4])<<24
 		newBytes := make([]byte, slen)
-		copy(newBytes, b[5:5+slen])
-		return newBytes, b[5+slen:]
+		copy(newBytes, data)
+		return newBytes, b[5+slen:], nil
 	case 'd':
-		if len(b) < 9 {
-			slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal number")
-			return nil, b
-		}
-		n := uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16 | uint64(b[4])<<24 |
-			uint64(b[5])<<32 | uint64(b[6])<<40 | uint64(b[7])<<48 | uint64(b[8])<<56
-		return math.Float64frombits(n), b[9:]
-	case 'i', 'w', 'm', 'q', 'p', 'l', 'n':
-		length := len(b)
-		if length < 2 {
-			slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal varint")
-			return nil, b
-		}
-		var ux uint64
-		var s uint32
-		i := 1
-		for ; i < 9; i++ {
-			if i >= length {
-				slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal varint:overflow")
-				return nil, b
-			}
-			m := b[i]
-			if m < 0x80 {
-				if i == 9 && m > 1 {
-					slog.LogWarning("rpc_unmarshal", "error:unknow unmarshal varint:overflow")
-					return nil, b
-				}
-				ux |= uint64(m) << s
-				break
+		tb := b[1:]
+		if legacy {
+			if len(tb) < 1 {
+				return nil, b, ErrRpcTruncated
 			}
-			ux |= uint64(m&0x7f) << s
-			s += 7
+			if tb[0] != '2' {
+				return nil, b, ErrRpcTag
+			}
+			tb = tb[1:]
+		}
+		if len(tb) < 8 {
+			return nil, b, ErrRpcTruncated
+		}
+		n := uint64(tb[0]) | uint64(tb[1])<<8 | uint64(tb[2])<<16 | uint64(tb[3])<<24 |
+			uint64(tb[4])<<32 | uint64(tb[5])<<40 | uint64(tb[6])<<48 | uint64(tb[7])<<56
+		return math.Float64frombits(n), tb[8:], nil
+	case 'e':
+		if len(b) < 5 {
+			return nil, b, ErrRpcTruncated
 		}
-		x := int64(ux >> 1)
-		if ux&1 != 0 {
-			x = ^x
+		n := uint32(b[1]) | uint32(b[2])<<8 | uint32(b[3])<<16 | uint32(b[4])<<24
+		return math.Float32frombits(n), b[5:], nil
+	case 'i', 'u', 'b', 'c', 'w', 'm', 'q', 'p', 'l', 'n':
+		x, n, err := readVarint(b[1:])
+		if err != nil {
+			return nil, b, err
 		}
-		return makeInteger(x, t), b[i+1:]
+		return makeInteger(x, t), b[1+n:], nil
 	case '[':
-		var key interface{}
-		var val interface{}
+		var key, val interface{}
+		var err error
 		tb := b[1:]
 		m := make(map[interface{}]interface{})
-		for tb[0] != ']' {
-			key, tb = RpcUnMarshal(tb)
-			val, tb = RpcUnMarshal(tb)
+		for {
+			if len(tb) == 0 {
+				return nil, b, ErrRpcTruncated
+			}
+			if tb[0] == ']' {
+				return m, tb[1:], nil
+			}
+			if key, tb, err = rpcDecode(tb, depth+1, legacy); err != nil {
+				return nil, b, err
+			}
+			switch key.(type) {
+			case []byte, []interface{}, map[interface{}]interface{}:
+				return nil, b, ErrRpcMapKey
+			}
+			if val, tb, err = rpcDecode(tb, depth+1, legacy); err != nil {
+				return nil, b, err
+			}
 			m[key] = val
 		}
-		return m, tb[1:]
 	case '{':
 		var val interface{}
-		index := 1
+		var err error
 		tb := b[1:]
 		lt := make([]interface{}, 0, 8)
-		for tb[0] != '}' {
-			val, tb = RpcUnMarshal(tb)
+		for {
+			if len(tb) == 0 {
+				return nil, b, ErrRpcTruncated
+			}
+			if tb[0] == '}' {
+				return lt, tb[1:], nil
+			}
+			if val, tb, err = rpcDecode(tb, depth+1, legacy); err != nil {
+				return nil, b, err
+			}
 			lt = append(lt, val)
-			index++
 		}
-		return lt, tb[1:]
 	default:
-		slog.LogError("rpc_unmarshal", "error rpc type %v", t)
-		//panic("error rpc type")
+		return nil, b, ErrRpcTag
+	}
+}
+
+// readVarint returns the zigzag decoded value and the bytes it used.
+func readVarint(b []byte) (int64, int, error) {
+	var ux uint64
+	var s uint
+	for i := 0; i < len(b); i++ {
+		m := b[i]
+		if i == 9 && m > 1 {
+			return 0, 0, ErrRpcVarint
+		}
+		if m < 0x80 {
+			ux |= uint64(m) << s
+			x := int64(ux >> 1)
+			if ux&1 != 0 {
+				x = ^x
+			}
+			return x, i + 1, nil
+		}
+		ux |= uint64(m&0x7f) << s
+		s += 7
+	}
+	return 0, 0, ErrRpcTruncated
+}
+
+func makeInteger(x int64, t byte) interface{} {
+	switch t {
+	case 'i':
+		return int(x)
+	case 'u':
+		return uint(x)
+	case 'b':
+		return int8(x)
+	case 'c':
+		return uint8(x)
+	case 'w':
+		return int16(x)
+	case 'm':
+		return uint16(x)
+	case 'q':
+		return int32(x)
+	case 'p':
+		return uint32(x)
+	case 'n':
+		return uint64(x)
+	default:
+		return x
+	}
+}
+
+// RpcDecodeTo decodes the first value of b into the value ptr points to,
+// converting numbers and filling structs by their field names or rpc tags.
+func RpcDecodeTo(b []byte, ptr interface{}) ([]byte, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return b, ErrRpcAssign
+	}
+	val, rest, err := RpcDecode(b)
+	if err != nil {
+		return b, err
+	}
+	if err := rpcAssign(v.Elem(), val); err != nil {
+		return b, err
+	}
+	return rest, nil
+}
+
+// RpcAssign sets dst, a settable value, from a decoded rpc value.
+func RpcAssign(dst reflect.Value, val interface{}) error {
+	return rpcAssign(dst, val)
+}
+
+func rpcAssign(dst reflect.Value, val interface{}) error {
+	if val == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	src := reflect.ValueOf(val)
+	switch dst.Kind() {
+	case reflect.Interface:
+		if !src.Type().AssignableTo(dst.Type()) {
+			return ErrRpcAssign
+		}
+		dst.Set(src)
+	case reflect.Ptr:
+		p := reflect.New(dst.Type().Elem())
+		if err := rpcAssign(p.Elem(), val); err != nil {
+			return err
+		}
+		dst.Set(p)
+	case reflect.Bool:
+		v, ok := val.(bool)
+		if !ok {
+			return ErrRpcAssign
+		}
+		dst.SetBool(v)
+	case reflect.String:
+		v, ok := val.(string)
+		if !ok {
+			return ErrRpcAssign
+		}
+		dst.SetString(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, ok := rpcInt(src)
+		if !ok || dst.OverflowInt(x) {
+			return ErrRpcAssign
+		}
+		dst.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, ok := rpcUint(src)
+		if !ok || dst.OverflowUint(x) {
+			return ErrRpcAssign
+		}
+		dst.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(src.Float())
+		default:
+			x, ok := rpcInt(src)
+			if !ok {
+				return ErrRpcAssign
+			}
+			dst.SetFloat(float64(x))
+		}
+	case reflect.Slice:
+		if bs, ok := val.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(bs)
+			return nil
+		}
+		list, ok := val.([]interface{})
+		if !ok {
+			return ErrRpcAssign
+		}
+		s := reflect.MakeSlice(dst.Type(), len(list), len(list))
+		for i, m := range list {
+			if err := rpcAssign(s.Index(i), m); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		list, ok := val.([]interface{})
+		if !ok || len(list) > dst.Len() {
+			return ErrRpcAssign
+		}
+		for i, m := range list {
+			if err := rpcAssign(dst.Index(i), m); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := val.(map[interface{}]interface{})
+		if !ok {
+			return ErrRpcAssign
+		}
+		t := dst.Type()
+		out := reflect.MakeMapWithSize(t, len(m))
+		for k, v := range m {
+			key := reflect.New(t.Key()).Elem()
+			if err := rpcAssign(key, k); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := rpcAssign(value, v); err != nil {
+				return err
+			}
+			out.SetMapIndex(key, value)
+		}
+		dst.Set(out)
+	case reflect.Struct:
+		m, ok := val.(map[interface{}]interface{})
+		if !ok {
+			return ErrRpcAssign
+		}
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := rpcFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			if v, ok := m[name]; ok {
+				if err := rpcAssign(dst.Field(i), v); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return ErrRpcAssign
+	}
+	return nil
+}
+
+func rpcInt(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x := v.Uint()
+		return int64(x), x <= math.MaxInt64
+	default:
+		return 0, false
+	}
+}
+
+func rpcUint(v reflect.Value) (uint64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x := v.Int()
+		return uint64(x), x >= 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), true
+	default:
+		return 0, false
 	}
-	return nil, b
 }
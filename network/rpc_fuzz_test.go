@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzRpcDecode(f *testing.F) {
+	for _, v := range []interface{}{nil, "s", []byte{0}, 1.5, -3, []interface{}{true, uint64(1)}, map[string]interface{}{"a": 1}} {
+		b, _ := RpcEncode(nil, v)
+		f.Add(b)
+	}
+	f.Add([]byte("{d2\x00\x00\x00\x00\x00\x00\xf8\x3f}"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		v, rest, err := RpcDecode(b)
+		if err != nil {
+			if !bytes.Equal(rest, b) {
+				t.Fatalf("error %v consumed the input", err)
+			}
+			return
+		}
+		if len(rest) > len(b) {
+			t.Fatalf("rest longer than the input")
+		}
+		if _, err := RpcEncode(nil, v); err != nil {
+			t.Fatalf("decoded %#v does not encode: %v", v, err)
+		}
+	})
+}
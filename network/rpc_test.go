@@ -0,0 +1,64 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRpcRoundTrip(t *testing.T) {
+	vals := []interface{}{
+		nil, true, false, "", "hello", []byte{1, 2, 3},
+		1.5, float32(-2.25), math.Inf(-1),
+		0, -1, uint(7), int8(-8), uint8(255), int16(-300), uint16(60000),
+		int32(math.MinInt32), uint32(math.MaxUint32), int64(math.MinInt64), uint64(math.MaxUint64),
+		[]interface{}{1, "a", []interface{}{nil}},
+		map[interface{}]interface{}{"k": int64(1), 2: []byte("v")},
+	}
+	for _, v := range vals {
+		b, err := RpcEncode(nil, v)
+		if err != nil {
+			t.Fatalf("encode %#v: %v", v, err)
+		}
+		if b[0] != RPC_FORMAT_VERSION {
+			t.Fatalf("encode %#v: version %d", v, b[0])
+		}
+		got, rest, err := RpcDecode(append(b, 'z'))
+		if err != nil {
+			t.Fatalf("decode %#v: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) || !bytes.Equal(rest, []byte{'z'}) {
+			t.Fatalf("decode %#v: got %#v rest %v", v, got, rest)
+		}
+	}
+}
+
+func TestRpcEncodeError(t *testing.T) {
+	b := []byte{'x'}
+	out, err := RpcMarshal(b, make(chan int))
+	if !errors.Is(err, ErrRpcType) || !bytes.Equal(out, b) {
+		t.Fatalf("encode chan: %v %v", out, err)
+	}
+}
+
+func TestRpcDecodeVersion(t *testing.T) {
+	if _, _, err := RpcUnMarshal([]byte{RPC_FORMAT_VERSION + 1, 'z'}); !errors.Is(err, ErrRpcVersion) {
+		t.Fatalf("unknown version: %v", err)
+	}
+	if _, _, err := RpcDecode([]byte{RPC_FORMAT_VERSION}); !errors.Is(err, ErrRpcTruncated) {
+		t.Fatalf("version only: %v", err)
+	}
+
+	// the unversioned format of the older nodes
+	n := math.Float64bits(1.5)
+	legacy := []byte{'{', 'd', '2', byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24), byte(n >> 32), byte(n >> 40), byte(n >> 48), byte(n >> 56), 'i', 4, '}'}
+	v, rest, err := RpcDecode(legacy)
+	if err != nil || len(rest) != 0 || !reflect.DeepEqual(v, []interface{}{1.5, 2}) {
+		t.Fatalf("legacy: %#v %v %v", v, rest, err)
+	}
+	if _, _, err := RpcDecode([]byte{'d', 'x', 0, 0, 0, 0, 0, 0, 0, 0}); !errors.Is(err, ErrRpcTag) {
+		t.Fatalf("legacy double tag: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jslyzt/einx/event"
+)
+
+// serverLinker is an accepted linker a server manager drains.
+type serverLinker interface {
+	Agent
+	Destroy()
+}
+
+// serverConns tracks the linkers accepted by a server manager so it can
+// drain them, the tcp, websocket and udp server managers embed it.
+type serverConns struct {
+	connLock  sync.Mutex
+	conns     map[AgentID]serverLinker
+	drainDone chan struct{}
+}
+
+func newServerConns() serverConns {
+	return serverConns{conns: make(map[AgentID]serverLinker)}
+}
+
+func (s *serverConns) addConn(c serverLinker) {
+	s.connLock.Lock()
+	s.conns[c.GetID()] = c
+	s.connLock.Unlock()
+}
+
+func (s *serverConns) removeConn(c serverLinker) {
+	s.connLock.Lock()
+	delete(s.conns, c.GetID())
+	if s.drainDone != nil && len(s.conns) == 0 {
+		close(s.drainDone)
+		s.drainDone = nil
+	}
+	s.connLock.Unlock()
+}
+
+// drainConns lets the SessionMgr say goodbye to every linker and closes them
+// once their write queue is flushed, waiting at most timeout. It returns
+// false when the linkers left were destroyed at the timeout.
+func (s *serverConns) drainConns(module EventReceiver, cid ComponentID, timeout int64) bool {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+
+	s.connLock.Lock()
+	conns := make([]serverLinker, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	done := make(chan struct{})
+	if len(s.conns) == 0 {
+		close(done)
+	} else {
+		s.drainDone = done
+	}
+	s.connLock.Unlock()
+
+	for _, c := range conns {
+		module.PostEvent(event.EVENT_TCP_DRAINING, c, cid, deadline)
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		s.connLock.Lock()
+		for _, c := range s.conns {
+			c.Close()
+			c.Destroy()
+		}
+		s.connLock.Unlock()
+		return false
+	}
+}
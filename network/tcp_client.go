@@ -1,27 +1,114 @@
 package network
 
 import (
+	"crypto/tls"
+	"errors"
+	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jslyzt/einx/event"
 	"github.com/jslyzt/einx/slog"
 )
 
+var (
+	ErrReconnectExhausted = errors.New("tcp link reconnect attempts exhausted")
+)
+
+type ReconnectOption struct {
+	min_delay    int64 //Millisecond
+	max_delay    int64 //Millisecond
+	jitter       float64
+	max_attempts int
+}
+
+func newReconnectOption() ReconnectOption {
+	o := ReconnectOption{
+		min_delay:    500,
+		max_delay:    30 * 1000,
+		jitter:       0.2,
+		max_attempts: 0,
+	}
+	return o
+}
+
+// delay returns the exponential backoff of the attempt, spread by the jitter ratio.
+func (o *ReconnectOption) delay(attempt int) time.Duration {
+	d := o.min_delay
+	for i := 1; i < attempt && d < o.max_delay; i++ {
+		d *= 2
+	}
+	if d > o.max_delay {
+		d = o.max_delay
+	}
+	if o.jitter > 0 {
+		spread := float64(d) * o.jitter
+		d += int64(spread * (2*rand.Float64() - 1))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+type tcpLink struct {
+	name      string
+	addr      string
+	user_type interface{}
+	closeFlag int32
+	closeChan chan struct{}
+	lock      sync.Mutex
+	conn      *TcpConn
+}
+
+func (l *tcpLink) isClosed() bool {
+	return atomic.LoadInt32(&l.closeFlag) == 1
+}
+
+func (l *tcpLink) close() {
+	if !atomic.CompareAndSwapInt32(&l.closeFlag, 0, 1) {
+		return
+	}
+	close(l.closeChan)
+	l.lock.Lock()
+	conn := l.conn
+	l.lock.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (l *tcpLink) setConn(conn *TcpConn) {
+	l.lock.Lock()
+	l.conn = conn
+	l.lock.Unlock()
+	if conn != nil && l.isClosed() {
+		conn.Close()
+	}
+}
+
 type TcpClientMgr struct {
 	name          string
 	component_id  ComponentID
 	module        EventReceiver
 	agent_handler SessionHandler
 	option        TransportOption
+	reconnect     ReconnectOption
+	dial_timeout  int64 //Millisecond
+	tls_config    *tls.Config
+	close_flag    int32
+	links_lock    sync.Mutex
+	links         map[string]*tcpLink
 }
 
 func NewTcpClientMgr(opts ...Option) Component {
 	tcp_client := &TcpClientMgr{
 		component_id: GenComponentID(),
-		option: TransportOption{
-			msg_max_length: MSG_MAX_BODY_LENGTH,
-			msg_max_count:  MSG_DEFAULT_COUNT,
-		},
+		option:       newTransportOption(),
+		reconnect:    newReconnectOption(),
+		links:        make(map[string]*tcpLink),
 	}
 
 	for _, opt := range opts {
@@ -52,23 +139,95 @@ func (mgr *TcpClientMgr) Start() bool {
 }
 
 func (mgr *TcpClientMgr) Close() {
+	if !atomic.CompareAndSwapInt32(&mgr.close_flag, 0, 1) {
+		return
+	}
+	mgr.links_lock.Lock()
+	links := mgr.links
+	mgr.links = make(map[string]*tcpLink)
+	mgr.links_lock.Unlock()
+	for _, link := range links {
+		link.close()
+	}
+}
 
+func (mgr *TcpClientMgr) isRunning() bool {
+	return atomic.LoadInt32(&mgr.close_flag) == 0
 }
 
 func (mgr *TcpClientMgr) Connect(addr string, user_type interface{}) {
 	go mgr.connect(addr, user_type)
 }
 
+// ConnectLink keeps the outbound link [name] alive, it is redialed with
+// backoff whenever the dial fails or the connection is closed.
+func (mgr *TcpClientMgr) ConnectLink(name string, addr string, user_type interface{}) {
+	link := &tcpLink{
+		name:      name,
+		addr:      addr,
+		user_type: user_type,
+		closeChan: make(chan struct{}),
+	}
+	mgr.links_lock.Lock()
+	if !mgr.isRunning() {
+		mgr.links_lock.Unlock()
+		return
+	}
+	if _, ok := mgr.links[name]; ok {
+		mgr.links_lock.Unlock()
+		slog.LogWarning("tcp_client", "tcp link [%v] has been connected", name)
+		return
+	}
+	mgr.links[name] = link
+	mgr.links_lock.Unlock()
+	go mgr.keepLink(link)
+}
+
+// CloseLink stops reconnecting the link [name] and closes its connection.
+func (mgr *TcpClientMgr) CloseLink(name string) {
+	mgr.links_lock.Lock()
+	link, ok := mgr.links[name]
+	if ok {
+		delete(mgr.links, name)
+	}
+	mgr.links_lock.Unlock()
+	if ok {
+		link.close()
+	}
+}
+
+// removeLink closes link and unregisters it unless a newer link took its name.
+func (mgr *TcpClientMgr) removeLink(link *tcpLink) {
+	mgr.links_lock.Lock()
+	if mgr.links[link.name] == link {
+		delete(mgr.links, link.name)
+	}
+	mgr.links_lock.Unlock()
+	link.close()
+}
+
+func (mgr *TcpClientMgr) dial(addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: time.Duration(mgr.dial_timeout) * time.Millisecond}
+	if mgr.tls_config != nil {
+		return tlsDial(dialer, addr, mgr.tls_config)
+	}
+	return dialer.Dial("tcp", addr)
+}
+
+func (mgr *TcpClientMgr) postError(user_type interface{}, err error) {
+	e := &event.ComponentEventMsg{}
+	e.MsgType = event.EVENT_COMPONENT_ERROR
+	e.Sender = mgr
+	e.Attach = user_type
+	e.Err = err
+	mgr.module.PushEventMsg(e)
+}
+
 func (mgr *TcpClientMgr) connect(addr string, user_type interface{}) {
-	raw_conn, err := net.Dial("tcp", addr)
+	raw_conn, err := mgr.dial(addr)
 	if err != nil {
 		slog.LogWarning("tcp_client", "tcp connect failed %v", err)
-		e := &event.ComponentEventMsg{}
-		e.MsgType = event.EVENT_COMPONENT_ERROR
-		e.Sender = mgr
-		e.Attach = user_type
-		e.Err = err
-		mgr.module.PushEventMsg(e)
+		mgr.postError(user_type, err)
 		return
 	}
 
@@ -87,6 +246,61 @@ func (mgr *TcpClientMgr) connect(addr string, user_type interface{}) {
 	}()
 }
 
+func (mgr *TcpClientMgr) keepLink(link *tcpLink) {
+	m := mgr.module
+	h := mgr.agent_handler
+	opt := &mgr.reconnect
+	connected := false
+	attempt := 0
+
+	for !link.isClosed() {
+		raw_conn, err := mgr.dial(link.addr)
+		if err != nil {
+			attempt++
+			if opt.max_attempts > 0 && attempt >= opt.max_attempts {
+				slog.LogWarning("tcp_client", "tcp link [%v] give up after %d attempts: %v", link.name, attempt, err)
+				mgr.removeLink(link)
+				mgr.postError(link.user_type, ErrReconnectExhausted)
+				return
+			}
+			m.PostEvent(event.EVENT_TCP_RECONNECTING, nil, mgr.component_id, link.name, link.user_type, attempt, err)
+			select {
+			case <-link.closeChan:
+				return
+			case <-time.After(opt.delay(attempt)):
+			}
+			continue
+		}
+
+		attempt = 0
+		tcp_agent := newTcpConn(raw_conn, h, Linker_TCP_OutGoing, &mgr.option)
+		tcp_agent.SetUserType(link.user_type)
+		link.setConn(tcp_agent)
+		if connected {
+			m.PostEvent(event.EVENT_TCP_RECONNECTED, tcp_agent, mgr.component_id)
+		} else {
+			m.PostEvent(event.EVENT_TCP_CONNECTED, tcp_agent, mgr.component_id)
+		}
+		connected = true
+
+		pingMgr.AddPing(tcp_agent)
+		err = tcp_agent.Run()
+		pingMgr.RemovePing(tcp_agent)
+		link.setConn(nil)
+		m.PostEvent(event.EVENT_TCP_CLOSED, tcp_agent, mgr.component_id, err)
+
+		if link.isClosed() {
+			return
+		}
+		m.PostEvent(event.EVENT_TCP_RECONNECTING, nil, mgr.component_id, link.name, link.user_type, 0, err)
+		select {
+		case <-link.closeChan:
+			return
+		case <-time.After(opt.delay(1)):
+		}
+	}
+}
+
 func (mgr *TcpClientMgr) GetOption() *TransportOption {
 	return &mgr.option
 }
@@ -6,30 +6,42 @@ import (
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/jslyzt/einx/agent"
-	"github.com/jslyzt/einx/queue"
 	"github.com/jslyzt/einx/slog"
 )
 
+// closeError is the reason a linker is closed for, passed to OnLinkerClosed.
+type closeError struct {
+	err error
+}
+
 type TcpConn struct {
 	agentID      AgentID
 	conn         net.Conn
 	closeFlag    uint32
-	writeQueue   *queue.CondQueue
+	drainFlag    int32
+	backlog      *writeBacklog
 	serveHandler SessionHandler
 	lastPingTick int64
+	pingSendTick int64 // the last ping answered by an incoming linker
 	remoteAddr   string
 	connType     int16
 	pingClose    int32
 	userType     interface{}
 
-	recvBuf       *BytesBuffer
-	writeBuf      *BytesBuffer
-	msgPacket     transPacket
-	recvCheckTime int64
-	msgRecvCount  int64
-	option        *TransportOption
+	recvBuf      *BytesBuffer
+	recvMsgBuf   *MsgBuffer
+	ownedRecv    bool
+	writeBuf     *BytesBuffer
+	msgPacket    transPacket
+	compressor   packetCompressor
+	decompressor packetDecompressor
+	cipher       *packetCipher
+	limiter      rateLimiter
+	closeErr     atomic.Value
+	option       *TransportOption
 }
 
 func newTcpConn(raw_conn net.Conn, h SessionHandler, conn_type int16, opt *TransportOption) *TcpConn {
@@ -37,18 +49,19 @@ func newTcpConn(raw_conn net.Conn, h SessionHandler, conn_type int16, opt *Trans
 	tcpAgent := &TcpConn{
 		conn:         raw_conn,
 		closeFlag:    0,
-		writeQueue:   queue.NewCondQueue(),
+		backlog:      newWriteBacklog(),
 		agentID:      agent.GenAgentID(),
 		serveHandler: h,
-		remoteAddr:   raw_conn.RemoteAddr().(*net.TCPAddr).String(),
+		remoteAddr:   raw_conn.RemoteAddr().String(),
 		connType:     conn_type,
 		userType:     0,
 
-		recvBuf:       bufferPool.Get().(*BytesBuffer),
-		writeBuf:      bufferPool.Get().(*BytesBuffer),
-		option:        opt,
-		lastPingTick:  nowTime,
-		recvCheckTime: nowTime,
+		recvBuf:      bufferPool.Get().(*BytesBuffer),
+		writeBuf:     bufferPool.Get().(*BytesBuffer),
+		option:       opt,
+		lastPingTick: nowTime,
+		pingSendTick: nowTime - opt.ping_time,
+		limiter:      newRateLimiter(opt, nowTime),
 	}
 	return tcpAgent
 }
@@ -79,8 +92,32 @@ func (n *TcpConn) IsClosed() bool {
 }
 
 func (n *TcpConn) doPushWrite(wrapper ITransportMsg) bool {
-	n.writeQueue.Push(wrapper)
-	return true
+	if wrapper == nil {
+		n.backlog.close()
+		return true
+	}
+	ok, err := n.backlog.push(n.option, wrapper, n.IsClosed)
+	if err != nil {
+		slog.LogWarning("tcp_conn", "linker [%v] %v", n.RemoteAddr(), err)
+		n.setCloseErr(err)
+		n.Close()
+		n.Destroy()
+	}
+	if !ok {
+		wrapper.reset()
+	}
+	return ok
+}
+
+func (n *TcpConn) setCloseErr(err error) {
+	n.closeErr.Store(closeError{err})
+}
+
+func (n *TcpConn) getCloseErr() error {
+	if v, ok := n.closeErr.Load().(closeError); ok {
+		return v.err
+	}
+	return nil
 }
 
 func (n *TcpConn) MultipleMsg() ITranMsgMultiple {
@@ -92,7 +129,7 @@ func (n *TcpConn) MultipleMsg() ITranMsgMultiple {
 var writePool *sync.Pool = &sync.Pool{New: func() interface{} { return new(TransportMsgPack) }}
 
 func (n *TcpConn) WriteMsg(msgID ProtoTypeID, b []byte) bool {
-	if n.IsClosed() {
+	if n.IsClosed() || uint32(len(b)) > n.option.msg_max_length {
 		return false
 	}
 
@@ -105,7 +142,7 @@ func (n *TcpConn) WriteMsg(msgID ProtoTypeID, b []byte) bool {
 }
 
 func (n *TcpConn) RpcCall(msgID ProtoTypeID, b []byte) bool {
-	if n.IsClosed() {
+	if n.IsClosed() || uint32(len(b)) > n.option.msg_max_length {
 		return false
 	}
 
@@ -128,6 +165,7 @@ func (n *TcpConn) RemoteAddr() net.Addr {
 func (n *TcpConn) Close() {
 	if atomic.CompareAndSwapUint32(&n.closeFlag, 0, 1) {
 		n.doPushWrite(nil)
+		n.backlog.wake()
 	}
 }
 
@@ -137,18 +175,60 @@ func (n *TcpConn) Destroy() {
 	}
 }
 
+// Drain closes the connection after every queued message is written,
+// the peer is given until deadline to read them.
+func (n *TcpConn) Drain(deadline time.Time) {
+	atomic.StoreInt32(&n.drainFlag, 1)
+	_ = n.conn.SetWriteDeadline(deadline)
+	_ = n.conn.SetReadDeadline(deadline)
+	n.Close()
+}
+
+func (n *TcpConn) isDraining() bool {
+	return atomic.LoadInt32(&n.drainFlag) == 1
+}
+
+func (n *TcpConn) closeWrite() {
+	if c, ok := n.conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	if isKcpSession(n.conn) {
+		return
+	}
+	n.Destroy()
+}
+
 func (n *TcpConn) Run() error {
 	defer n.recover()
 
+	if n.option.encrypt {
+		if err := n.handshake(); err != nil {
+			slog.LogWarning("tcp_conn", "tcp [%v] handshake error: %v", n.remoteAddr, err)
+			n.Close()
+			n.Destroy()
+			return err
+		}
+	}
+
 	go func() {
 		defer n.recover()
 		if !n.Write() {
 			n.Close()
-			n.Destroy()
+			if n.isDraining() {
+				n.closeWrite() // wait the peer to close after reading the flushed msgs
+			} else {
+				n.Destroy()
+			}
 		}
 	}()
 
 	if !n.Recv() {
+		n.Close()
+		n.Destroy()
+		if err := n.getCloseErr(); err != nil {
+			return err
+		}
 		return errors.New("tcp transport recv error")
 	}
 	return nil
@@ -169,6 +249,11 @@ func (n *TcpConn) DoPong(nowTick int64) {
 		return
 	}
 
+	// answer a ping per half ping_time at most, a peer flooding pings gets no echo
+	if nowTick-n.pingSendTick < n.option.ping_time/2 {
+		return
+	}
+	n.pingSendTick = nowTick
 	n.DoPing()
 }
 
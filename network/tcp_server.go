@@ -1,6 +1,7 @@
 package network
 
 import (
+	"crypto/tls"
 	"net"
 	"sync/atomic"
 	"time"
@@ -20,6 +21,8 @@ type TcpServerMgr struct {
 	addr         string
 	closeFlag    int32
 	option       TransportOption
+	tlsConfig    *tls.Config
+	serverConns
 }
 
 func NewTcpServerMgr(opts ...Option) Component {
@@ -27,6 +30,7 @@ func NewTcpServerMgr(opts ...Option) Component {
 		componentID: GenComponentID(),
 		closeFlag:   0,
 		option:      newTransportOption(),
+		serverConns: newServerConns(),
 	}
 
 	for _, opt := range opts {
@@ -65,13 +69,18 @@ func (mgr *TcpServerMgr) Start() bool {
 		slog.LogError("tcp_server", "ListenTCP addr:[%s],Error:%s", mgr.addr, err.Error())
 		return false
 	}
+	if mgr.tlsConfig != nil {
+		listener = tls.NewListener(listener, mgr.tlsConfig)
+	}
 	mgr.listener = listener
+	tcp_servers.Store(mgr.componentID, mgr)
 	go mgr.doTcpAccept()
 	return true
 }
 
 func (mgr *TcpServerMgr) Close() {
 	if atomic.CompareAndSwapInt32(&mgr.closeFlag, 0, 1) {
+		tcp_servers.Delete(mgr.componentID)
 		if mgr.listener == nil {
 			return
 		}
@@ -79,14 +88,21 @@ func (mgr *TcpServerMgr) Close() {
 	}
 }
 
+// Drain stops accepting and drains the accepted linkers, waiting at most
+// timeout.
+func (mgr *TcpServerMgr) Drain(timeout int64) {
+	mgr.Close()
+	if !mgr.drainConns(mgr.module, mgr.componentID, timeout) {
+		slog.LogWarning("tcp_server", "tcp server [%v] drain timeout", mgr.addr)
+	}
+}
+
 func (mgr *TcpServerMgr) isRunning() bool {
 	close_flag := atomic.LoadInt32(&mgr.closeFlag)
 	return close_flag == 0
 }
 
 func (mgr *TcpServerMgr) doTcpAccept() {
-	m := mgr.module
-	h := mgr.agentHandler
 	listener := mgr.listener
 
 	for mgr.isRunning() {
@@ -100,16 +116,29 @@ func (mgr *TcpServerMgr) doTcpAccept() {
 			continue
 		}
 
-		tcpAgent := newTcpConn(rawConn, h, Linker_TCP_InComming, &mgr.option)
-		m.PostEvent(event.EVENT_TCP_ACCEPTED, tcpAgent, mgr.componentID)
+		go mgr.serveConn(rawConn)
+	}
+}
 
-		go func() {
-			pingMgr.AddPing(tcpAgent)
-			err := tcpAgent.Run()
-			pingMgr.RemovePing(tcpAgent)
-			m.PostEvent(event.EVENT_TCP_CLOSED, tcpAgent, mgr.componentID, err)
-		}()
+func (mgr *TcpServerMgr) serveConn(rawConn net.Conn) {
+	if tlsConn, ok := rawConn.(*tls.Conn); ok {
+		if err := tlsHandshake(tlsConn); err != nil {
+			slog.LogWarning("tcp_server", "tls handshake %v error: %v", rawConn.RemoteAddr(), err)
+			_ = rawConn.Close()
+			return
+		}
 	}
+
+	m := mgr.module
+	tcpAgent := newTcpConn(rawConn, mgr.agentHandler, Linker_TCP_InComming, &mgr.option)
+	mgr.addConn(tcpAgent)
+	m.PostEvent(event.EVENT_TCP_ACCEPTED, tcpAgent, mgr.componentID)
+
+	pingMgr.AddPing(tcpAgent)
+	err := tcpAgent.Run()
+	pingMgr.RemovePing(tcpAgent)
+	mgr.removeConn(tcpAgent)
+	m.PostEvent(event.EVENT_TCP_CLOSED, tcpAgent, mgr.componentID, err)
 }
 
 func (mgr *TcpServerMgr) GetOption() *TransportOption {
@@ -0,0 +1,95 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+const TLS_HANDSHAKE_TIMEOUT = 5000 //Millisecond
+
+func tlsConfigOf(t interface{}) *tls.Config {
+	p := tlsConfigRef(t)
+	if *p == nil {
+		*p = &tls.Config{}
+	}
+	return *p
+}
+
+func tlsConfigRef(t interface{}) **tls.Config {
+	switch v := t.(type) {
+	case *TcpServerMgr:
+		return &v.tlsConfig
+	case *TcpClientMgr:
+		return &v.tls_config
+	case *WsServerMgr:
+		return &v.tlsConfig
+	case *WsClientMgr:
+		return &v.tls_config
+	default:
+		panic("option network tls unknown type")
+	}
+}
+
+// mergeTLSConfig returns a copy of cfg keeping the certificates and cas of cur
+// that cfg leaves out, cur may be nil.
+func mergeTLSConfig(cur *tls.Config, cfg *tls.Config) *tls.Config {
+	c := cfg.Clone()
+	if cur == nil {
+		return c
+	}
+	c.Certificates = append(append([]tls.Certificate(nil), cur.Certificates...), c.Certificates...)
+	if c.RootCAs == nil {
+		c.RootCAs = cur.RootCAs
+	}
+	if c.ClientCAs == nil {
+		c.ClientCAs = cur.ClientCAs
+	}
+	if c.ClientAuth == tls.NoClientCert {
+		c.ClientAuth = cur.ClientAuth
+	}
+	return c
+}
+
+func loadCertPool(caFile string) *x509.CertPool {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		panic("option network tls ca file: " + err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		panic("option network tls ca file has no certificate: " + caFile)
+	}
+	return pool
+}
+
+func tlsHandshake(conn *tls.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(TLS_HANDSHAKE_TIMEOUT * time.Millisecond))
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+func tlsDial(dialer *net.Dialer, addr string, cfg *tls.Config) (net.Conn, error) {
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, cfg)
+}
+
+// PeerCertificate returns the verified certificate of the peer on tls links, nil otherwise.
+func (n *TcpConn) PeerCertificate() *x509.Certificate {
+	if c, ok := n.conn.(*tls.Conn); ok {
+		certs := c.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			return certs[0]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert              *x509.Certificate
+	key               *ecdsa.PrivateKey
+	certFile, keyFile string
+}
+
+// newTestCert writes a certificate for 127.0.0.1 signed by ca, or a self
+// signed ca when ca is nil.
+func newTestCert(t *testing.T, name string, ca *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testCert{key: key}
+	if c.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c.certFile = filepath.Join(dir, name+".crt")
+	c.keyFile = filepath.Join(dir, name+".key")
+	writePem(t, c.certFile, "CERTIFICATE", der)
+	writePem(t, c.keyFile, "EC PRIVATE KEY", keyDer)
+	return c
+}
+
+func writePem(t *testing.T, file string, kind string, der []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsPair handshakes a client dialing a server configured by the options, it
+// returns the errors of both sides and the client certificate the server got.
+func tlsPair(t *testing.T, serverOpts []Option, clientOpts []Option) (error, error, *x509.Certificate) {
+	server := &TcpServerMgr{}
+	for _, opt := range serverOpts {
+		opt(server)
+	}
+	client := &TcpClientMgr{}
+	for _, opt := range clientOpts {
+		opt(client)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l = tls.NewListener(l, server.tlsConfig)
+	type accepted struct {
+		err  error
+		peer *x509.Certificate
+	}
+	done := make(chan accepted, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- accepted{err: err}
+			return
+		}
+		defer conn.Close()
+		n := &TcpConn{conn: conn}
+		err = tlsHandshake(conn.(*tls.Conn))
+		if err == nil {
+			// the client checks the server certificate first
+			_, err = conn.Read(make([]byte, 1))
+		}
+		done <- accepted{err, n.PeerCertificate()}
+	}()
+
+	conn, cerr := tlsDial(&net.Dialer{Timeout: time.Second}, l.Addr().String(), client.tls_config)
+	if cerr == nil {
+		_, cerr = conn.Write([]byte{1})
+		defer conn.Close()
+	}
+	select {
+	case a := <-done:
+		return a.err, cerr, a.peer
+	case <-time.After(2 * TLS_HANDSHAKE_TIMEOUT * time.Millisecond):
+		t.Fatal("tls handshake blocked")
+	}
+	return nil, nil, nil
+}
+
+func TestTLSHandshake(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+
+	serr, cerr, peer := tlsPair(t,
+		[]Option{TLSCertFile(server.certFile, server.keyFile)},
+		[]Option{TLSCAFile(ca.certFile)})
+	if serr != nil || cerr != nil || peer != nil {
+		t.Fatalf("tls: server %v client %v peer %v", serr, cerr, peer)
+	}
+
+	other := newTestCert(t, "other", nil)
+	if _, cerr, _ = tlsPair(t,
+		[]Option{TLSCertFile(server.certFile, server.keyFile)},
+		[]Option{TLSCAFile(other.certFile)}); cerr == nil {
+		t.Fatalf("server certificate of an unknown ca accepted")
+	}
+}
+
+func TestMutualTLSHandshake(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "client", ca)
+	serverOpts := []Option{TLSCertFile(server.certFile, server.keyFile), TLSCAFile(ca.certFile)}
+
+	serr, cerr, peer := tlsPair(t, serverOpts,
+		[]Option{TLSCAFile(ca.certFile), TLSCertFile(client.certFile, client.keyFile)})
+	if serr != nil || cerr != nil {
+		t.Fatalf("mutual tls: server %v client %v", serr, cerr)
+	}
+	if peer == nil || peer.Subject.CommonName != "client" {
+		t.Fatalf("peer certificate %v", peer)
+	}
+
+	if serr, _, _ = tlsPair(t, serverOpts, []Option{TLSCAFile(ca.certFile)}); serr == nil {
+		t.Fatalf("client without a certificate accepted")
+	}
+}
+
+// TestTLSConfigMerge gives TLSConfig after and before the file options, the
+// certificates and cas are kept both ways.
+func TestTLSConfigMerge(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "client", ca)
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	serverOpts := []Option{TLSCertFile(server.certFile, server.keyFile), TLSCAFile(ca.certFile), TLSConfig(base)}
+	clientOpts := []Option{TLSConfig(base), TLSCAFile(ca.certFile), TLSCertFile(client.certFile, client.keyFile)}
+	serr, cerr, peer := tlsPair(t, serverOpts, clientOpts)
+	if serr != nil || cerr != nil || peer == nil {
+		t.Fatalf("merged mutual tls: server %v client %v peer %v", serr, cerr, peer)
+	}
+
+	s := &TcpServerMgr{}
+	for _, opt := range serverOpts {
+		opt(s)
+	}
+	if s.tlsConfig.MinVersion != tls.VersionTLS12 || s.tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("merged config %v %v", s.tlsConfig.MinVersion, s.tlsConfig.ClientAuth)
+	}
+	if base.Certificates != nil || base.ClientCAs != nil {
+		t.Fatalf("TLSConfig changed the config given")
+	}
+	TLSConfig(&tls.Config{ClientAuth: tls.NoClientCert, Certificates: []tls.Certificate{{}}})(s)
+	if len(s.tlsConfig.Certificates) != 2 || s.tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("second config %d certificates %v", len(s.tlsConfig.Certificates), s.tlsConfig.ClientAuth)
+	}
+}
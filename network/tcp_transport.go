@@ -5,55 +5,126 @@ import (
 	"errors"
 	"io"
 	"net"
+	"time"
+
+	"github.com/jslyzt/einx/slog"
 )
 
 const (
 	MSG_KEY_LENGTH         = 32
-	MSG_HEADER_LENGTH      = 4
+	MSG_MAGIC              = 0xE0
+	MSG_VERSION            = 1
+	MSG_HEADER_LENGTH      = 11
 	MSG_ID_LENGTH          = 4
 	MSG_MAX_BODY_LENGTH    = 8096
 	MSG_DEFAULT_BUF_LENGTH = 1024
 	MSG_DEFAULT_COUNT      = 100
 	MSG_COUNT_CHECK_TIME   = 3000
+	MSG_WRITE_BATCH_COUNT  = 64
+	MSG_WRITE_BATCH_BYTES  = 64 * 1024
 )
 
 var bigEndian = binary.BigEndian
 
-// --------------------------------------------------------------------------------------------------------
-// |                                header              |                body                          |
-// | type byte | body_length uint16 | packet_flag uint8 | msg_id uint32| msg_data []byte               |
-// --------------------------------------------------------------------------------------------------------
-var msgHeaderLength int = MSG_HEADER_LENGTH
+// ---------------------------------------------------------------------------------------------------------------
+// |                                         header                                          |      body       |
+// | magic_version uint8 | type byte | packet_flag uint8 | body_length uint32 | msg_id uint32 | msg_data []byte |
+// ---------------------------------------------------------------------------------------------------------------
+// magic_version is MSG_MAGIC | MSG_VERSION, body_length is the length of msg_data
+// and must not exceed the msg max length on both sides. 'T' packets have no body.
 
 var (
 	ErrMsgTooLong = errors.New("msg packet length too long")
+	ErrMsgMagic   = errors.New("msg packet magic error")
+	ErrMsgVersion = errors.New("msg packet version not supported")
 )
 
 type transPacket struct {
+	Version    uint8
 	MsgType    byte
-	BodyLength uint16
 	PacketFlag uint8
+	BodyLength uint32
+	MsgID      ProtoTypeID
+}
+
+func (p *transPacket) encode(b []byte) {
+	b[0] = MSG_MAGIC | MSG_VERSION
+	b[1] = p.MsgType
+	b[2] = p.PacketFlag
+	bigEndian.PutUint32(b[3:], p.BodyLength)
+	bigEndian.PutUint32(b[7:], p.MsgID)
+}
+
+func (p *transPacket) decode(b []byte, max_length uint32) error {
+	if b[0]&0xF0 != MSG_MAGIC {
+		return ErrMsgMagic
+	}
+	p.Version = b[0] & 0x0F
+	if p.Version == 0 || p.Version > MSG_VERSION {
+		return ErrMsgVersion
+	}
+	p.MsgType = b[1]
+	p.PacketFlag = b[2]
+	p.BodyLength = bigEndian.Uint32(b[3:])
+	p.MsgID = bigEndian.Uint32(b[7:])
+	if p.BodyLength > max_length {
+		return ErrMsgTooLong
+	}
+	return nil
+}
+
+// packPacket appends one framed packet to buf.
+func packPacket(buf *BytesBuffer, msgType byte, flag uint8, msgID ProtoTypeID, b []byte) {
+	p := transPacket{
+		MsgType:    msgType,
+		PacketFlag: flag,
+		BodyLength: uint32(len(b)),
+		MsgID:      msgID,
+	}
+	buf.Reserve(MSG_HEADER_LENGTH + len(b))
+	p.encode(buf.WriteBuf())
+	buf.Write(MSG_HEADER_LENGTH)
+	buf.WriteBytes(b)
 }
 
 type tcpTransport = TcpConn
 
+// Write coalesces the msgs queued at each wakeup into the write buffer and
+// sends them with one conn.Write per write_batch_bytes.
 func (n *tcpTransport) Write() bool {
 	tcpConn := n.conn
-	wq := n.writeQueue
-	msgList := make([]interface{}, 16)
+	wq := n.backlog.queue
+	opt := n.option
+	batch := uint32(opt.write_batch_count)
+	msgList := make([]interface{}, batch)
 	for {
-		c := wq.Get(msgList, 16)
+		c := wq.Get(msgList, batch)
+		if opt.write_flush_delay > 0 && c > 0 && c < batch {
+			time.Sleep(time.Duration(opt.write_flush_delay) * time.Millisecond)
+			c += wq.TryGet(msgList[c:], batch-c)
+		}
+
+		closing := false
 		for i := uint32(0); i < c; i++ {
 			m := msgList[i]
-			if m == nil {
-				goto writeClose
+			msgList[i] = nil
+			if m == nil || closing {
+				closing = true
+				continue
 			}
 			wg := m.(ITransportMsg)
-			if !n.WriteMsgPacket(tcpConn, wg) {
+			ok := n.packTransportMsg(wg)
+			n.backlog.done(wg)
+			wg.reset()
+			if !ok {
 				goto writeClose
 			}
-			msgList[i] = nil
-			wg.reset()
+			if n.writeBuf.Count() >= opt.write_batch_bytes && !n.flush(tcpConn) {
+				goto writeClose
+			}
+		}
+		if !n.flush(tcpConn) || closing {
+			goto writeClose
 		}
 	}
 writeClose:
@@ -64,68 +135,115 @@ writeClose:
 }
 
 func (n *tcpTransport) WriteMsgPacket(conn net.Conn, msg ITransportMsg) bool {
+	return n.packTransportMsg(msg) && n.flush(conn)
+}
+
+func (n *tcpTransport) packTransportMsg(msg ITransportMsg) bool {
 	switch msg.GetType() {
 	case 'P', 'R':
-		tsBuf := msg.(*TransportMsgPack)
-		n.packMsgBuf(tsBuf)
+		n.packMsgBuf(msg.(*TransportMsgPack))
+	case 'B':
+		for _, m := range msg.(*TransportMultiple).msgArray {
+			n.packMsgBuf(m)
+		}
+	case 'S':
+		n.packBroadcast(msg.(*BroadcastMsg))
 	case 'T':
-		n.packPingMsg()
+		packPacket(n.writeBuf, 'T', 0, 0, nil)
 	default:
 		return false
 	}
+	return true
+}
+
+func (n *tcpTransport) packBroadcast(msg *BroadcastMsg) {
+	if n.cipher != nil || uint32(len(msg.Buf)) > n.option.msg_max_length {
+		n.packMsgBuf(&TransportMsgPack{msgType: 'P', msgID: msg.msgID, Buf: msg.Buf})
+		return
+	}
+	frame := msg.frame(n.option, &n.compressor)
+	n.writeBuf.Reserve(len(frame))
+	n.writeBuf.WriteBytes(frame)
+}
 
+func (n *tcpTransport) flush(conn net.Conn) bool {
 	buf := n.writeBuf
-	rb := buf.ReadBuf(buf.Count())
-	_, err := conn.Write(rb)
+	if buf.Count() == 0 {
+		return true
+	}
+	_, err := conn.Write(buf.ReadBuf(buf.Count()))
 	return err == nil
 }
 
 func (n *tcpTransport) packMsgBuf(msg *TransportMsgPack) {
-	mBytes := msg.Buf
-	var bodyLength int = len(mBytes) + MSG_ID_LENGTH
-	var msgLength int = bodyLength + MSG_HEADER_LENGTH
-
-	buf := n.writeBuf
-	buf.Reserve(msgLength)
-
-	var wl int = 0
-	wl += buf.WriteUint8(msg.msgType)
-	wl += buf.WriteUint32(uint32(bodyLength))
-	wl += buf.WriteUint8(0)
-
-	wl += buf.WriteUint32(msg.msgID)
-	wl += buf.WriteBytes(mBytes)
-}
+	if uint32(len(msg.Buf)) > n.option.msg_max_length {
+		slog.LogWarning("tcp_transport", "drop msg [%v] length %d: %v", msg.msgID, len(msg.Buf), ErrMsgTooLong)
+		return
+	}
 
-func (n *tcpTransport) packPingMsg() {
-	buf := n.writeBuf
-	buf.Reserve(MSG_HEADER_LENGTH)
-	buffer := buf.WriteBuf()
-	buffer[0] = 'T'
-	buffer[1] = 0
-	buffer[2] = 0
-	buffer[3] = 0
-	buf.Write(MSG_HEADER_LENGTH)
+	b, flag := msg.Buf, uint8(0)
+	opt := n.option
+	if opt.compress_flag != 0 && len(b) >= opt.compress_threshold {
+		cb, cflag, err := n.compressor.compress(opt.compress_flag, b)
+		if err != nil {
+			slog.LogWarning("tcp_transport", "compress msg [%v] error: %v", msg.msgID, err)
+		} else {
+			b, flag = cb, cflag
+		}
+	}
+	if n.cipher != nil {
+		b = n.cipher.seal(msg.msgType, msg.msgID, b)
+		flag |= PACKET_FLAG_ENCRYPT
+	}
+	packPacket(n.writeBuf, msg.msgType, flag, msg.msgID, b)
 }
 
 func (n *tcpTransport) Recv() bool {
 	tcpConn := n.conn
 	serve := n.serveHandler
+	bufHandler, owned := serve.(BufferHandler)
+	n.ownedRecv = owned
 	msgPacket := &n.msgPacket
 
 	for {
 		msgID, msg, err := n.ReadMsgPacket(tcpConn)
+		mb := n.recvMsgBuf
+		n.recvMsgBuf = nil
 		if err != nil {
+			if mb != nil {
+				mb.Release()
+			}
 			goto waitClose
 		}
 
 		nowTick := UnixTS()
 
+		// pings count too, an incoming linker answers them
+		ok, err := n.limiter.allow(n.option, nowTick)
+		if !ok && mb != nil {
+			mb.Release()
+		}
+		if err != nil {
+			n.setCloseErr(err)
+			goto waitClose
+		}
+		if !ok {
+			continue
+		}
+
 		switch msgPacket.MsgType {
 		case 'P':
-			serve.ServeHandler(n, msgID, msg)
+			if owned {
+				bufHandler.ServeMsgBuffer(n, msgID, mb)
+			} else {
+				serve.ServeHandler(n, msgID, msg)
+			}
 		case 'R':
-			serve.ServeRpc(n, msgID, msg)
+			if owned {
+				bufHandler.ServeRpcBuffer(n, msgID, mb)
+			} else {
+				serve.ServeRpc(n, msgID, msg)
+			}
 		case 'T':
 			n.Pong(nowTick)
 		default:
@@ -140,51 +258,71 @@ waitClose:
 	return false
 }
 
+// ReadMsgPacket returns the msg body borrowed from the receive buffer, for
+// BufferHandler linkers the 'P' and 'R' bodies are read straight into the
+// MsgBuffer left in recvMsgBuf instead.
 func (n *tcpTransport) ReadMsgPacket(conn net.Conn) (ProtoTypeID, []byte, error) {
-	buf := n.writeBuf
+	buf := n.recvBuf
+	buf.Reset()
 	buf.Reserve(MSG_HEADER_LENGTH)
-
-	mBytes := buf.WriteBuf()
-	var rl int = 0
-	rl, err := io.ReadFull(conn, mBytes)
-
-	if err != nil {
+	header := buf.WriteBuf()[:MSG_HEADER_LENGTH]
+	if _, err := io.ReadFull(conn, header); err != nil {
 		return 0, nil, err
 	}
 
-	buf.write(rl)
-
+	max_length := n.option.msg_max_length
+	if n.cipher != nil {
+		max_length += MSG_SEAL_OVERHEAD
+	}
 	msgPacket := &n.msgPacket
-
-	msgPacket.MsgType = mBytes[0]
-	msgPacket.BodyLength = bigEndian.Uint16(mBytes[1:])
-	msgPacket.PacketFlag = mBytes[3]
-
-	if msgPacket.MsgType == 'T' {
-		return 0, nil, nil
+	if err := msgPacket.decode(header, max_length); err != nil {
+		return 0, nil, err
 	}
-
-	if uint32(msgPacket.BodyLength) >= n.option.msg_max_length {
-		return 0, nil, ErrMsgTooLong
+	isMsg := msgPacket.MsgType == 'P' || msgPacket.MsgType == 'R'
+
+	var body []byte
+	if n.ownedRecv && isMsg {
+		n.recvMsgBuf = getMsgBuffer(int(msgPacket.BodyLength))
+		body = n.recvMsgBuf.Bytes()
+	} else {
+		buf.Reset()
+		buf.Reserve(int(msgPacket.BodyLength))
+		body = buf.WriteBuf()[:msgPacket.BodyLength]
+		buf.Write(len(body))
 	}
-
-	buf.Reserve(int(msgPacket.BodyLength))
-
-	mBytes = buf.WriteBuf()
-
-	rl, err = io.ReadFull(conn, mBytes)
-	if err != nil {
-		return 0, nil, err
+	if len(body) > 0 {
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return 0, nil, err
+		}
 	}
 
-	buf.write(rl)
-
-	if rl < MSG_ID_LENGTH {
-		return 0, nil, errors.New("msg packet length error")
+	encrypted := msgPacket.PacketFlag&PACKET_FLAG_ENCRYPT != 0
+	if n.cipher != nil && isMsg {
+		if !encrypted {
+			return 0, nil, ErrMsgDecrypt
+		}
+		b, err := n.cipher.open(msgPacket.MsgType, msgPacket.MsgID, body)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = b
+	} else if encrypted {
+		return 0, nil, ErrMsgDecrypt
 	}
 
-	var msgID ProtoTypeID = 0
-	msgID = bigEndian.Uint32(mBytes)
-	msgBody := mBytes[MSG_ID_LENGTH:]
-	return msgID, msgBody, nil
+	if compress := msgPacket.PacketFlag & PACKET_FLAG_COMPRESS_MASK; compress != 0 {
+		b, err := n.decompressor.decompress(compress, body, n.option.msg_max_length)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = b
+		if n.recvMsgBuf != nil {
+			n.recvMsgBuf.Release()
+			n.recvMsgBuf = NewMsgBuffer(body)
+		}
+	}
+	if n.recvMsgBuf != nil {
+		n.recvMsgBuf.setLen(len(body))
+	}
+	return msgPacket.MsgID, body, nil
 }
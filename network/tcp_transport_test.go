@@ -0,0 +1,158 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+func newTestConn(conn net.Conn, opt *TransportOption) *TcpConn {
+	return newTcpConn(conn, nil, Linker_TCP_OutGoing, opt)
+}
+
+// pipeWrite writes the raw packets to the pipe and closes it.
+func pipeWrite(conn net.Conn, packets ...[]byte) {
+	go func() {
+		for _, p := range packets {
+			if _, err := conn.Write(p); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+}
+
+func rawPacket(magic uint8, msgType byte, msgID ProtoTypeID, length uint32, body []byte) []byte {
+	p := transPacket{MsgType: msgType, BodyLength: length, MsgID: msgID}
+	b := make([]byte, MSG_HEADER_LENGTH, MSG_HEADER_LENGTH+len(body))
+	p.encode(b)
+	b[0] = magic
+	return append(b, body...)
+}
+
+func TestMsgPacketRoundTrip(t *testing.T) {
+	opt := newTransportOption()
+	r, w := net.Pipe()
+	defer r.Close()
+
+	sender := newTestConn(w, &opt)
+	go func() {
+		sender.WriteMsgPacket(w, &TransportMsgPack{msgType: 'P', msgID: 7, Buf: []byte("hello")})
+		sender.WriteMsgPacket(w, &TransportMsgPack{msgType: 'R', msgID: 8})
+		w.Close()
+	}()
+
+	n := newTestConn(r, &opt)
+	msgID, body, err := n.ReadMsgPacket(r)
+	if err != nil || msgID != 7 || n.msgPacket.MsgType != 'P' || string(body) != "hello" {
+		t.Fatalf("read %v %q %c %v", msgID, body, n.msgPacket.MsgType, err)
+	}
+	msgID, body, err = n.ReadMsgPacket(r)
+	if err != nil || msgID != 8 || n.msgPacket.MsgType != 'R' || len(body) != 0 {
+		t.Fatalf("read empty body %v %q %c %v", msgID, body, n.msgPacket.MsgType, err)
+	}
+	if _, _, err = n.ReadMsgPacket(r); err != io.EOF {
+		t.Fatalf("read after close %v", err)
+	}
+}
+
+func TestMsgPacketMaxLength(t *testing.T) {
+	opt := newTransportOption()
+	opt.msg_max_length = 64
+	max := bytes.Repeat([]byte{'x'}, 64)
+
+	r, w := net.Pipe()
+	defer r.Close()
+	pipeWrite(w,
+		rawPacket(MSG_MAGIC|MSG_VERSION, 'P', 1, 64, max),
+		rawPacket(MSG_MAGIC|MSG_VERSION, 'P', 2, 65, append(max, 'x')),
+	)
+	n := newTestConn(r, &opt)
+	if _, body, err := n.ReadMsgPacket(r); err != nil || !bytes.Equal(body, max) {
+		t.Fatalf("read max length %d %v", len(body), err)
+	}
+	if _, _, err := n.ReadMsgPacket(r); !errors.Is(err, ErrMsgTooLong) {
+		t.Fatalf("read max length + 1 %v", err)
+	}
+
+	sender := newTestConn(w, &opt)
+	if sender.WriteMsg(3, append(max, 'x')) {
+		t.Fatalf("write max length + 1 queued")
+	}
+}
+
+func TestMsgPacketHeaderError(t *testing.T) {
+	cases := []struct {
+		name  string
+		magic uint8
+		err   error
+	}{
+		{"magic", 0x10 | MSG_VERSION, ErrMsgMagic},
+		{"version 0", MSG_MAGIC, ErrMsgVersion},
+		{"version", MSG_MAGIC | (MSG_VERSION + 1), ErrMsgVersion},
+	}
+	for _, c := range cases {
+		opt := newTransportOption()
+		r, w := net.Pipe()
+		pipeWrite(w, rawPacket(c.magic, 'P', 1, 2, []byte("ok")))
+		n := newTestConn(r, &opt)
+		if _, _, err := n.ReadMsgPacket(r); !errors.Is(err, c.err) {
+			t.Errorf("%s: %v, want %v", c.name, err, c.err)
+		}
+		r.Close()
+	}
+}
+
+func TestMsgPacketTruncated(t *testing.T) {
+	full := rawPacket(MSG_MAGIC|MSG_VERSION, 'P', 1, 10, []byte("0123456789"))
+	cases := []struct {
+		name string
+		b    []byte
+	}{
+		{"header", full[:MSG_HEADER_LENGTH-4]},
+		{"body", full[:MSG_HEADER_LENGTH+3]},
+	}
+	for _, c := range cases {
+		opt := newTransportOption()
+		r, w := net.Pipe()
+		pipeWrite(w, c.b)
+		n := newTestConn(r, &opt)
+		if _, _, err := n.ReadMsgPacket(r); err != io.ErrUnexpectedEOF {
+			t.Errorf("%s: %v, want %v", c.name, err, io.ErrUnexpectedEOF)
+		}
+		r.Close()
+	}
+}
+
+// BenchmarkWrite compares the batched writes with a write per msg.
+func BenchmarkWrite(b *testing.B) {
+	for _, batch := range []int{1, MSG_WRITE_BATCH_COUNT} {
+		b.Run(fmt.Sprintf("batch_%d", batch), func(b *testing.B) {
+			opt := newTransportOption()
+			opt.write_batch_count = batch
+			r, w := net.Pipe()
+			defer r.Close()
+			go io.Copy(io.Discard, r)
+
+			n := newTestConn(w, &opt)
+			done := make(chan struct{})
+			go func() {
+				n.Write()
+				close(done)
+			}()
+			body := make([]byte, 64)
+			b.SetBytes(int64(MSG_HEADER_LENGTH + len(body)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n.WriteMsg(1, body)
+			}
+			n.Close()
+			<-done
+			b.StopTimer()
+			w.Close()
+		})
+	}
+}
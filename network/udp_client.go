@@ -0,0 +1,129 @@
+package network
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+type UdpClientMgr struct {
+	name          string
+	component_id  ComponentID
+	module        EventReceiver
+	agent_handler SessionHandler
+	option        TransportOption
+	kcp           KcpOption
+	close_flag    int32
+}
+
+func NewUdpClientMgr(opts ...Option) Component {
+	udp_client := &UdpClientMgr{
+		component_id: GenComponentID(),
+		option:       newTransportOption(),
+		kcp:          newKcpOption(),
+	}
+
+	for _, opt := range opts {
+		opt(udp_client)
+	}
+
+	if udp_client.agent_handler == nil {
+		panic("option agent handler is nil")
+	}
+
+	if udp_client.module == nil {
+		panic("option agent handler is nil")
+	}
+
+	return udp_client
+}
+
+func (mgr *UdpClientMgr) GetID() ComponentID {
+	return mgr.component_id
+}
+
+func (mgr *UdpClientMgr) GetType() ComponentType {
+	return COMPONENT_TYPE_UDP_CLIENT
+}
+
+func (mgr *UdpClientMgr) Start() bool {
+	return true
+}
+
+func (mgr *UdpClientMgr) Close() {
+	atomic.StoreInt32(&mgr.close_flag, 1)
+}
+
+// Connect opens a reliable udp session with a random conversation id.
+func (mgr *UdpClientMgr) Connect(addr string, user_type interface{}) {
+	go mgr.connect(addr, 0, user_type)
+}
+
+// ConnectConv opens a reliable udp session with the conversation id conv,
+// e.g. one handed out by a login server over tcp.
+func (mgr *UdpClientMgr) ConnectConv(addr string, conv uint32, user_type interface{}) {
+	go mgr.connect(addr, conv, user_type)
+}
+
+// dial returns the packet conn to close after the session when it is not owned by the session.
+func (mgr *UdpClientMgr) dial(addr string, conv uint32) (*kcp.UDPSession, net.PacketConn, error) {
+	if conv == 0 {
+		session, err := kcp.DialWithOptions(addr, nil, 0, 0)
+		return session, nil, err
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := kcp.NewConn3(conv, raddr, nil, 0, 0, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return session, conn, nil
+}
+
+func (mgr *UdpClientMgr) connect(addr string, conv uint32, user_type interface{}) {
+	if atomic.LoadInt32(&mgr.close_flag) == 1 {
+		return
+	}
+
+	session, packet_conn, err := mgr.dial(addr, conv)
+	if err != nil {
+		slog.LogWarning("udp_client", "udp connect failed %v", err)
+		e := &event.ComponentEventMsg{}
+		e.MsgType = event.EVENT_COMPONENT_ERROR
+		e.Sender = mgr
+		e.Attach = user_type
+		e.Err = err
+		mgr.module.PushEventMsg(e)
+		return
+	}
+	mgr.kcp.apply(session)
+
+	m := mgr.module
+	udp_agent := newTcpConn(session, mgr.agent_handler, Linker_TCP_OutGoing, &mgr.option)
+	udp_agent.SetUserType(user_type)
+	m.PostEvent(event.EVENT_TCP_CONNECTED, udp_agent, mgr.component_id)
+
+	go func() {
+		pingMgr.AddPing(udp_agent)
+		err := udp_agent.Run()
+		pingMgr.RemovePing(udp_agent)
+		if packet_conn != nil {
+			_ = packet_conn.Close()
+		}
+		m.PostEvent(event.EVENT_TCP_CLOSED, udp_agent, mgr.component_id, err)
+	}()
+}
+
+func (mgr *UdpClientMgr) GetOption() *TransportOption {
+	return &mgr.option
+}
@@ -0,0 +1,68 @@
+package network
+
+import (
+	"net"
+
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// KcpOption tunes the arq of the reliable udp sessions, see SetNoDelay of kcp.
+// The defaults favour latency: nodelay, 10ms interval, fast resend after 2 acks and no congestion control.
+type KcpOption struct {
+	nodelay  int
+	interval int
+	resend   int
+	nc       int
+	snd_wnd  int
+	rcv_wnd  int
+	mtu      int
+}
+
+func newKcpOption() KcpOption {
+	o := KcpOption{
+		nodelay:  1,
+		interval: 10,
+		resend:   2,
+		nc:       1,
+		snd_wnd:  256,
+		rcv_wnd:  256,
+		mtu:      1350,
+	}
+	return o
+}
+
+func (o *KcpOption) apply(s *kcp.UDPSession) {
+	s.SetStreamMode(true)
+	s.SetWriteDelay(false)
+	s.SetNoDelay(o.nodelay, o.interval, o.resend, o.nc)
+	s.SetWindowSize(o.snd_wnd, o.rcv_wnd)
+	s.SetMtu(o.mtu)
+	s.SetACKNoDelay(o.nodelay == 1)
+}
+
+func kcpOptionOf(t interface{}) *KcpOption {
+	switch v := t.(type) {
+	case *UdpServerMgr:
+		return &v.kcp
+	case *UdpClientMgr:
+		return &v.kcp
+	default:
+		panic("option network kcp unknown type")
+	}
+}
+
+// GetConv returns the conversation id identifying a reliable udp linker, 0 for the other linkers.
+func (n *TcpConn) GetConv() uint32 {
+	if s, ok := n.conn.(*kcp.UDPSession); ok {
+		return s.GetConv()
+	}
+	return 0
+}
+
+// isKcpSession reports a reliable udp session. It has no half close, so a
+// drained session is kept open to retransmit the msgs the peer did not ack
+// yet, until the peer closes it or the drain deadline ends the read.
+func isKcpSession(c net.Conn) bool {
+	_, ok := c.(*kcp.UDPSession)
+	return ok
+}
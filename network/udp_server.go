@@ -0,0 +1,134 @@
+package network
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// UdpServerMgr accepts reliable udp sessions, their linkers frame and
+// dispatch msgs exactly like tcp linkers.
+type UdpServerMgr struct {
+	name         string
+	listener     *kcp.Listener
+	componentID  ComponentID
+	module       EventReceiver
+	agentHandler SessionHandler
+	addr         string
+	closeFlag    int32
+	option       TransportOption
+	kcp          KcpOption
+	serverConns
+}
+
+func NewUdpServerMgr(opts ...Option) Component {
+	udpServer := &UdpServerMgr{
+		componentID: GenComponentID(),
+		option:      newTransportOption(),
+		kcp:         newKcpOption(),
+		serverConns: newServerConns(),
+	}
+
+	for _, opt := range opts {
+		opt(udpServer)
+	}
+
+	if udpServer.agentHandler == nil {
+		panic("option agent handler is nil")
+	}
+
+	if udpServer.module == nil {
+		panic("option agent handler is nil")
+	}
+
+	return udpServer
+}
+
+func (mgr *UdpServerMgr) GetID() ComponentID {
+	return mgr.componentID
+}
+
+func (mgr *UdpServerMgr) GetType() ComponentType {
+	return COMPONENT_TYPE_UDP_SERVER
+}
+
+func (mgr *UdpServerMgr) Address() net.Addr {
+	if mgr.listener == nil {
+		return nil
+	}
+	return mgr.listener.Addr()
+}
+
+func (mgr *UdpServerMgr) Start() bool {
+	listener, err := kcp.ListenWithOptions(mgr.addr, nil, 0, 0)
+	if err != nil {
+		slog.LogError("udp_server", "ListenUDP addr:[%s],Error:%s", mgr.addr, err.Error())
+		return false
+	}
+	mgr.listener = listener
+	tcp_servers.Store(mgr.componentID, mgr)
+	go mgr.doUdpAccept()
+	return true
+}
+
+func (mgr *UdpServerMgr) Close() {
+	if atomic.CompareAndSwapInt32(&mgr.closeFlag, 0, 1) {
+		tcp_servers.Delete(mgr.componentID)
+		if mgr.listener == nil {
+			return
+		}
+		_ = mgr.listener.Close()
+	}
+}
+
+// Drain stops accepting and drains the accepted linkers, waiting at most
+// timeout.
+func (mgr *UdpServerMgr) Drain(timeout int64) {
+	mgr.Close()
+	if !mgr.drainConns(mgr.module, mgr.componentID, timeout) {
+		slog.LogWarning("udp_server", "udp server [%v] drain timeout", mgr.addr)
+	}
+}
+
+func (mgr *UdpServerMgr) isRunning() bool {
+	return atomic.LoadInt32(&mgr.closeFlag) == 0
+}
+
+func (mgr *UdpServerMgr) doUdpAccept() {
+	listener := mgr.listener
+
+	for mgr.isRunning() {
+		session, err := listener.AcceptKCP()
+		if err != nil {
+			if mgr.isRunning() {
+				slog.LogError("udp_server", "Accept Error: %v", err)
+				time.Sleep(TCP_ACCEPT_SLEEP)
+				continue
+			}
+			return
+		}
+		mgr.kcp.apply(session)
+		go mgr.serveConn(session)
+	}
+}
+
+func (mgr *UdpServerMgr) serveConn(session *kcp.UDPSession) {
+	m := mgr.module
+	udpAgent := newTcpConn(session, mgr.agentHandler, Linker_TCP_InComming, &mgr.option)
+	mgr.addConn(udpAgent)
+	m.PostEvent(event.EVENT_TCP_ACCEPTED, udpAgent, mgr.componentID)
+
+	pingMgr.AddPing(udpAgent)
+	err := udpAgent.Run()
+	pingMgr.RemovePing(udpAgent)
+	mgr.removeConn(udpAgent)
+	m.PostEvent(event.EVENT_TCP_CLOSED, udpAgent, mgr.componentID, err)
+}
+
+func (mgr *UdpServerMgr) GetOption() *TransportOption {
+	return &mgr.option
+}
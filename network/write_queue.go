@@ -0,0 +1,190 @@
+package network
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jslyzt/einx/queue"
+)
+
+// policies applied when a msg is written while the write queue of a linker is over its high water mark
+const (
+	WRITE_POLICY_BLOCK       = iota // wait until the queue is flushed under the mark
+	WRITE_POLICY_DROP_NEWEST        // drop the msg, WriteMsg returns false
+	WRITE_POLICY_DROP_OLDEST        // queue the msg and drop the oldest queued msgs
+	WRITE_POLICY_DISCONNECT         // close the linker with ErrWriteQueueFull
+)
+
+var (
+	ErrWriteQueueFull = errors.New("write queue high water mark exceeded")
+)
+
+func transportMsgSize(m ITransportMsg) (int64, int64) {
+	switch v := m.(type) {
+	case *TransportMsgPack:
+		if v.msgType == 'T' {
+			return 0, 0
+		}
+		return 1, int64(len(v.Buf))
+	case *BroadcastMsg:
+		return 1, int64(len(v.Buf))
+	case *TransportMultiple:
+		return int64(len(v.msgArray)), int64(v.count)
+	default:
+		return 0, 0
+	}
+}
+
+// writeBacklog accounts the msgs queued but not yet written by a linker.
+// Pings and the close marker are never limited nor dropped.
+type writeBacklog struct {
+	queue  *queue.CondQueue
+	msgs   int64
+	bytes  int64
+	lock   sync.Mutex
+	cond   *sync.Cond
+	closed bool // the close marker is queued, guarded by lock
+}
+
+func newWriteBacklog() *writeBacklog {
+	b := &writeBacklog{
+		queue: queue.NewCondQueue(),
+	}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+func (b *writeBacklog) depth() (int, int) {
+	return int(atomic.LoadInt64(&b.msgs)), int(atomic.LoadInt64(&b.bytes))
+}
+
+// over tells whether adding msgs and bytes passes the mark, a msg is always
+// accepted by an empty queue whatever its size.
+func (b *writeBacklog) over(opt *TransportOption, msgs int64, bytes int64) bool {
+	queued := atomic.LoadInt64(&b.msgs)
+	if queued == 0 {
+		return false
+	}
+	if opt.write_max_msgs > 0 && queued+msgs > opt.write_max_msgs {
+		return true
+	}
+	return opt.write_max_bytes > 0 && atomic.LoadInt64(&b.bytes)+bytes > opt.write_max_bytes
+}
+
+func (b *writeBacklog) add(msgs int64, bytes int64) {
+	atomic.AddInt64(&b.msgs, msgs)
+	atomic.AddInt64(&b.bytes, bytes)
+}
+
+// push queues m, it returns false when m is dropped and ErrWriteQueueFull
+// when the linker must be disconnected.
+func (b *writeBacklog) push(opt *TransportOption, m ITransportMsg, closed func() bool) (bool, error) {
+	msgs, bytes := transportMsgSize(m)
+	if msgs == 0 || (opt.write_max_msgs <= 0 && opt.write_max_bytes <= 0) {
+		b.add(msgs, bytes)
+		b.queue.Push(m)
+		return true, nil
+	}
+
+	switch opt.write_policy {
+	case WRITE_POLICY_DROP_NEWEST:
+		if b.over(opt, msgs, bytes) {
+			return false, nil
+		}
+	case WRITE_POLICY_DISCONNECT:
+		if b.over(opt, msgs, bytes) {
+			return false, ErrWriteQueueFull
+		}
+	case WRITE_POLICY_DROP_OLDEST:
+		b.lock.Lock()
+		ok := b.dropOldest(opt, m, msgs, bytes)
+		b.lock.Unlock()
+		return ok, nil
+	default:
+		b.lock.Lock()
+		for b.over(opt, msgs, bytes) && !closed() {
+			b.cond.Wait()
+		}
+		b.lock.Unlock()
+		if closed() {
+			return false, nil
+		}
+	}
+	b.add(msgs, bytes)
+	b.queue.Push(m)
+	return true, nil
+}
+
+// dropOldest drops the oldest msgs until m fits and queues m, it is called
+// with b.lock held. The pings keep their order and the close marker stays last,
+// m is dropped once the marker is queued.
+func (b *writeBacklog) dropOldest(opt *TransportOption, m ITransportMsg, msgs int64, bytes int64) bool {
+	if b.closed {
+		return false
+	}
+	var held []interface{}
+	for b.over(opt, msgs, bytes) {
+		v, ok := b.queue.Pop()
+		if !ok {
+			break
+		}
+		old, _ := v.(ITransportMsg)
+		c, bs := transportMsgSize(old)
+		if c == 0 {
+			held = append(held, v)
+			continue
+		}
+		b.add(-c, -bs)
+		old.reset()
+	}
+	b.cond.Broadcast()
+	if len(held) > 0 {
+		// requeue the held pings ahead of the msgs left
+		for {
+			v, ok := b.queue.Pop()
+			if !ok {
+				break
+			}
+			held = append(held, v)
+		}
+		for _, v := range held {
+			b.queue.Push(v)
+		}
+	}
+	b.add(msgs, bytes)
+	b.queue.Push(m)
+	return true
+}
+
+// close queues the close marker, the write loop stops at it.
+func (b *writeBacklog) close() {
+	b.lock.Lock()
+	b.closed = true
+	b.queue.Push(nil)
+	b.lock.Unlock()
+}
+
+// done is called once m has been written or dropped.
+func (b *writeBacklog) done(m ITransportMsg) {
+	msgs, bytes := transportMsgSize(m)
+	if msgs == 0 {
+		return
+	}
+	b.add(-msgs, -bytes)
+	b.wake()
+}
+
+func (b *writeBacklog) wake() {
+	b.lock.Lock()
+	b.cond.Broadcast()
+	b.lock.Unlock()
+}
+
+func (n *TcpConn) QueueDepth() (int, int) {
+	return n.backlog.depth()
+}
+
+func (n *WsConn) QueueDepth() (int, int) {
+	return n.backlog.depth()
+}
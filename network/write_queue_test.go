@@ -0,0 +1,64 @@
+package network
+
+import (
+	"testing"
+)
+
+func queuedMsgs(b *writeBacklog) []interface{} {
+	list := make([]interface{}, b.queue.Count())
+	n := b.queue.TryGet(list, uint32(len(list)))
+	return list[:n]
+}
+
+func TestDropOldestKeepsOrder(t *testing.T) {
+	opt := newTransportOption()
+	opt.write_max_msgs = 2
+	opt.write_policy = WRITE_POLICY_DROP_OLDEST
+	never := func() bool { return false }
+
+	b := newWriteBacklog()
+	ping1 := &TransportMsgPack{msgType: 'T'}
+	ping2 := &TransportMsgPack{msgType: 'T'}
+	msgs := make([]*TransportMsgPack, 4)
+	for i := range msgs {
+		msgs[i] = &TransportMsgPack{msgType: 'P', msgID: ProtoTypeID(i + 1), Buf: []byte{byte(i)}}
+	}
+	for _, m := range []ITransportMsg{ping1, msgs[0], ping2, msgs[1], msgs[2], msgs[3]} {
+		if ok, err := b.push(&opt, m, never); !ok || err != nil {
+			t.Fatalf("push %v: %v %v", m, ok, err)
+		}
+	}
+
+	want := []interface{}{ping1, ping2, msgs[2], msgs[3]}
+	got := queuedMsgs(b)
+	if len(got) != len(want) {
+		t.Fatalf("queued %d msgs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("msg %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+	if queued, _ := b.depth(); queued != 2 {
+		t.Fatalf("depth %d, want 2", queued)
+	}
+}
+
+func TestDropOldestAfterClose(t *testing.T) {
+	opt := newTransportOption()
+	opt.write_max_msgs = 1
+	opt.write_policy = WRITE_POLICY_DROP_OLDEST
+	never := func() bool { return false }
+
+	b := newWriteBacklog()
+	m1 := &TransportMsgPack{msgType: 'P', msgID: 1, Buf: []byte{1}}
+	b.push(&opt, m1, never)
+	b.close()
+	if ok, _ := b.push(&opt, &TransportMsgPack{msgType: 'P', msgID: 2, Buf: []byte{2}}, never); ok {
+		t.Fatalf("msg queued after the close marker")
+	}
+	got := queuedMsgs(b)
+	if len(got) != 2 || got[0] != m1 || got[1] != nil {
+		t.Fatalf("queued %v, want the msg and the close marker", got)
+	}
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+type WsClientMgr struct {
+	name          string
+	component_id  ComponentID
+	module        EventReceiver
+	agent_handler SessionHandler
+	option        TransportOption
+	dial_timeout  int64 //Millisecond
+	tls_config    *tls.Config
+	close_flag    int32
+}
+
+func NewWsClientMgr(opts ...Option) Component {
+	ws_client := &WsClientMgr{
+		component_id: GenComponentID(),
+		option:       newTransportOption(),
+	}
+
+	for _, opt := range opts {
+		opt(ws_client)
+	}
+
+	if ws_client.agent_handler == nil {
+		panic("option agent handler is nil")
+	}
+
+	if ws_client.module == nil {
+		panic("option agent handler is nil")
+	}
+
+	return ws_client
+}
+
+func (mgr *WsClientMgr) GetID() ComponentID {
+	return mgr.component_id
+}
+
+func (mgr *WsClientMgr) GetType() ComponentType {
+	return COMPONENT_TYPE_WS_CLIENT
+}
+
+func (mgr *WsClientMgr) Start() bool {
+	return true
+}
+
+func (mgr *WsClientMgr) Close() {
+	atomic.StoreInt32(&mgr.close_flag, 1)
+}
+
+// Connect dials the websocket url, e.g. ws://127.0.0.1:8080/ or wss://host/game.
+func (mgr *WsClientMgr) Connect(url string, user_type interface{}) {
+	go mgr.connect(url, user_type)
+}
+
+func (mgr *WsClientMgr) connect(url string, user_type interface{}) {
+	if atomic.LoadInt32(&mgr.close_flag) == 1 {
+		return
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:            websocket.DefaultDialer.Proxy,
+		HandshakeTimeout: time.Duration(mgr.dial_timeout) * time.Millisecond,
+		TLSClientConfig:  mgr.tls_config,
+	}
+	raw_conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		slog.LogWarning("ws_client", "ws connect failed %v", err)
+		e := &event.ComponentEventMsg{}
+		e.MsgType = event.EVENT_COMPONENT_ERROR
+		e.Sender = mgr
+		e.Attach = user_type
+		e.Err = err
+		mgr.module.PushEventMsg(e)
+		return
+	}
+
+	m := mgr.module
+	ws_agent := newWsConn(raw_conn, mgr.agent_handler, Linker_TCP_OutGoing, &mgr.option)
+	ws_agent.SetUserType(user_type)
+	m.PostEvent(event.EVENT_TCP_CONNECTED, ws_agent, mgr.component_id)
+
+	go func() {
+		pingMgr.AddPing(ws_agent)
+		err := ws_agent.Run()
+		pingMgr.RemovePing(ws_agent)
+		m.PostEvent(event.EVENT_TCP_CLOSED, ws_agent, mgr.component_id, err)
+	}()
+}
+
+func (mgr *WsClientMgr) GetOption() *TransportOption {
+	return &mgr.option
+}
@@ -0,0 +1,380 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jslyzt/einx/agent"
+	"github.com/jslyzt/einx/slog"
+)
+
+// ------------------------------------------------------------
+// |                    websocket binary frame                |
+// | type byte ('P' or 'R') | msg_id uint32 | msg_data []byte |
+// ------------------------------------------------------------
+// keep alive uses the websocket ping and pong control frames.
+const WS_FRAME_HEADER_LENGTH = 1 + MSG_ID_LENGTH
+
+var (
+	ErrWsFrameType   = errors.New("websocket frame type error")
+	ErrWsFrameLength = errors.New("websocket frame length error")
+)
+
+type WsConn struct {
+	agentID      AgentID
+	conn         *websocket.Conn
+	closeFlag    uint32
+	drainFlag    int32
+	backlog      *writeBacklog
+	serveHandler SessionHandler
+	lastPingTick int64
+	connType     int16
+	userType     interface{}
+	option       *TransportOption
+	limiter      rateLimiter
+	closeErr     atomic.Value
+}
+
+func newWsConn(raw_conn *websocket.Conn, h SessionHandler, conn_type int16, opt *TransportOption) *WsConn {
+	wsAgent := &WsConn{
+		conn:         raw_conn,
+		backlog:      newWriteBacklog(),
+		agentID:      agent.GenAgentID(),
+		serveHandler: h,
+		connType:     conn_type,
+		userType:     0,
+		option:       opt,
+		lastPingTick: UnixTS(),
+		limiter:      newRateLimiter(opt, UnixTS()),
+	}
+	raw_conn.SetReadLimit(int64(opt.msg_max_length) + WS_FRAME_HEADER_LENGTH)
+	raw_conn.SetPingHandler(wsAgent.onPing)
+	raw_conn.SetPongHandler(wsAgent.onPong)
+	return wsAgent
+}
+
+func (n *WsConn) GetID() AgentID {
+	return n.agentID
+}
+
+func (n *WsConn) GetType() int16 {
+	return n.connType
+}
+
+func (n *WsConn) GetUserType() interface{} {
+	return n.userType
+}
+
+func (n *WsConn) SetUserType(t interface{}) {
+	n.userType = t
+}
+
+func (n *WsConn) IsClosed() bool {
+	return atomic.LoadUint32(&n.closeFlag) == 1
+}
+
+func (n *WsConn) doPushWrite(wrapper ITransportMsg) bool {
+	if wrapper == nil {
+		n.backlog.close()
+		return true
+	}
+	ok, err := n.backlog.push(n.option, wrapper, n.IsClosed)
+	if err != nil {
+		slog.LogWarning("ws_conn", "linker [%v] %v", n.RemoteAddr(), err)
+		n.setCloseErr(err)
+		n.Close()
+		n.Destroy()
+	}
+	if !ok {
+		wrapper.reset()
+	}
+	return ok
+}
+
+func (n *WsConn) setCloseErr(err error) {
+	n.closeErr.Store(closeError{err})
+}
+
+func (n *WsConn) getCloseErr() error {
+	if v, ok := n.closeErr.Load().(closeError); ok {
+		return v.err
+	}
+	return nil
+}
+
+func (n *WsConn) MultipleMsg() ITranMsgMultiple {
+	x := &TransportMultiple{}
+	x.trans = n
+	return x
+}
+
+func (n *WsConn) WriteMsg(msgID ProtoTypeID, b []byte) bool {
+	if n.IsClosed() || uint32(len(b)) > n.option.msg_max_length {
+		return false
+	}
+
+	w := writePool.Get().(*TransportMsgPack)
+	w.msgType = 'P'
+	w.msgID = msgID
+	w.Buf = b
+
+	return n.doPushWrite(w)
+}
+
+func (n *WsConn) RpcCall(msgID ProtoTypeID, b []byte) bool {
+	if n.IsClosed() || uint32(len(b)) > n.option.msg_max_length {
+		return false
+	}
+
+	w := writePool.Get().(*TransportMsgPack)
+	w.msgType = 'R'
+	w.msgID = msgID
+	w.Buf = b
+
+	return n.doPushWrite(w)
+}
+
+func (n *WsConn) LocalAddr() net.Addr {
+	return n.conn.LocalAddr()
+}
+
+func (n *WsConn) RemoteAddr() net.Addr {
+	return n.conn.RemoteAddr()
+}
+
+func (n *WsConn) PeerCertificate() *x509.Certificate {
+	if c, ok := n.conn.UnderlyingConn().(*tls.Conn); ok {
+		certs := c.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			return certs[0]
+		}
+	}
+	return nil
+}
+
+func (n *WsConn) Close() {
+	if atomic.CompareAndSwapUint32(&n.closeFlag, 0, 1) {
+		n.doPushWrite(nil)
+		n.backlog.wake()
+	}
+}
+
+func (n *WsConn) Destroy() {
+	_ = n.conn.Close()
+}
+
+// Drain sends a close frame after every queued message is written,
+// the peer is given until deadline to answer it.
+func (n *WsConn) Drain(deadline time.Time) {
+	atomic.StoreInt32(&n.drainFlag, 1)
+	_ = n.conn.SetWriteDeadline(deadline)
+	_ = n.conn.SetReadDeadline(deadline)
+	n.Close()
+}
+
+func (n *WsConn) Run() error {
+	defer n.recover()
+
+	go func() {
+		defer n.recover()
+		n.write()
+		n.Close()
+		if atomic.LoadInt32(&n.drainFlag) == 1 {
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+			_ = n.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		} else {
+			n.Destroy()
+		}
+	}()
+
+	err := n.recv()
+	n.Close()
+	n.Destroy()
+	if closeErr := n.getCloseErr(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+func (n *WsConn) write() {
+	wq := n.backlog.queue
+	msgList := make([]interface{}, 16)
+	for {
+		c := wq.Get(msgList, 16)
+		for i := uint32(0); i < c; i++ {
+			m := msgList[i]
+			if m == nil {
+				return
+			}
+			msgList[i] = nil
+			wg := m.(ITransportMsg)
+			ok := n.writeTransportMsg(wg)
+			n.backlog.done(wg)
+			wg.reset()
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (n *WsConn) writeTransportMsg(msg ITransportMsg) bool {
+	switch msg.GetType() {
+	case 'P', 'R':
+		return n.writeFrame(msg.(*TransportMsgPack)) == nil
+	case 'S':
+		m := msg.(*BroadcastMsg)
+		return n.writeFrame(&TransportMsgPack{msgType: 'P', msgID: m.msgID, Buf: m.Buf}) == nil
+	case 'B':
+		for _, m := range msg.(*TransportMultiple).msgArray {
+			if n.writeFrame(m) != nil {
+				return false
+			}
+		}
+		return true
+	case 'T':
+		deadline := time.Now().Add(time.Duration(n.option.ping_time) * time.Millisecond)
+		return n.conn.WriteControl(websocket.PingMessage, nil, deadline) == nil
+	default:
+		return false
+	}
+}
+
+func (n *WsConn) writeFrame(msg *TransportMsgPack) error {
+	w, err := n.conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return err
+	}
+	var header [WS_FRAME_HEADER_LENGTH]byte
+	header[0] = msg.msgType
+	bigEndian.PutUint32(header[1:], msg.msgID)
+	if _, err = w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err = w.Write(msg.Buf); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (n *WsConn) recv() error {
+	serve := n.serveHandler
+	for {
+		frameType, b, err := n.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if frameType != websocket.BinaryMessage {
+			return ErrWsFrameType
+		}
+		if len(b) < WS_FRAME_HEADER_LENGTH {
+			return ErrWsFrameLength
+		}
+
+		ok, err := n.limiter.allow(n.option, UnixTS())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		msgID := bigEndian.Uint32(b[1:])
+		body := b[WS_FRAME_HEADER_LENGTH:]
+		bufHandler, owned := serve.(BufferHandler)
+		switch {
+		case b[0] == 'P' && owned:
+			bufHandler.ServeMsgBuffer(n, msgID, &MsgBuffer{b: body, ref: 1, class: -1})
+		case b[0] == 'R' && owned:
+			bufHandler.ServeRpcBuffer(n, msgID, &MsgBuffer{b: body, ref: 1, class: -1})
+		case b[0] == 'P':
+			serve.ServeHandler(n, msgID, body)
+		case b[0] == 'R':
+			serve.ServeRpc(n, msgID, body)
+		default:
+			return ErrWsFrameType
+		}
+	}
+}
+
+// onPing is called in the recv goroutine, the ping frames are rate limited
+// as the msgs are.
+func (n *WsConn) onPing(data string) error {
+	ok, err := n.limiter.allow(n.option, UnixTS())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	n.Pong(UnixTS())
+	err = n.conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	if err == websocket.ErrCloseSent {
+		return nil
+	}
+	return err
+}
+
+func (n *WsConn) onPong(data string) error {
+	n.Pong(UnixTS())
+	return nil
+}
+
+func (n *WsConn) Pong(nowTick int64) {
+	if n.IsClosed() {
+		return
+	}
+
+	pingMgr.DoPong(n, nowTick)
+}
+
+func (n *WsConn) DoPong(nowTick int64) {
+	n.lastPingTick = nowTick
+}
+
+// Ping is sent by both sides, browsers answer the ping frames without any script.
+func (n *WsConn) Ping() bool {
+	if n.IsClosed() {
+		return false
+	}
+
+	duration := n.option.ping_time
+	checkTime := UnixTS() - n.lastPingTick
+	if checkTime <= (duration*2 + 500) {
+		n.DoPing()
+		return true
+	}
+
+	n.Close()
+	return false
+}
+
+func (n *WsConn) DoPing() {
+	wrapper := &TransportMsgPack{
+		msgType: 'T',
+		msgID:   0,
+		Buf:     nil,
+	}
+	n.doPushWrite(wrapper)
+}
+
+func (n *WsConn) recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	slog.LogError("ws_recovery", "recover error :%v", r)
+	slog.LogError("ws_recovery", "%s", string(debug.Stack()))
+	n.Close()
+	n.Destroy()
+}
+
+func (n *WsConn) GetOption() *TransportOption {
+	return n.option
+}
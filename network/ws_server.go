@@ -0,0 +1,134 @@
+package network
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/jslyzt/einx/event"
+	"github.com/jslyzt/einx/slog"
+)
+
+type WsServerMgr struct {
+	name         string
+	listener     net.Listener
+	server       *http.Server
+	upgrader     websocket.Upgrader
+	componentID  ComponentID
+	module       EventReceiver
+	agentHandler SessionHandler
+	addr         string
+	path         string
+	closeFlag    int32
+	option       TransportOption
+	tlsConfig    *tls.Config
+	serverConns
+}
+
+func NewWsServerMgr(opts ...Option) Component {
+	wsServer := &WsServerMgr{
+		componentID: GenComponentID(),
+		path:        "/",
+		option:      newTransportOption(),
+		serverConns: newServerConns(),
+	}
+	for _, opt := range opts {
+		opt(wsServer)
+	}
+
+	if wsServer.agentHandler == nil {
+		panic("option agent handler is nil")
+	}
+
+	if wsServer.module == nil {
+		panic("option agent handler is nil")
+	}
+
+	return wsServer
+}
+
+func (mgr *WsServerMgr) GetID() ComponentID {
+	return mgr.componentID
+}
+
+func (mgr *WsServerMgr) GetType() ComponentType {
+	return COMPONENT_TYPE_WS_SERVER
+}
+
+func (mgr *WsServerMgr) Address() net.Addr {
+	if mgr.listener == nil {
+		return nil
+	}
+	return mgr.listener.Addr()
+}
+
+func (mgr *WsServerMgr) Start() bool {
+	listener, err := net.Listen("tcp", mgr.addr)
+	if err != nil {
+		slog.LogError("ws_server", "Listen addr:[%s],Error:%s", mgr.addr, err.Error())
+		return false
+	}
+	if mgr.tlsConfig != nil {
+		listener = tls.NewListener(listener, mgr.tlsConfig)
+	}
+	mgr.listener = listener
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(mgr.path, mgr.serveHTTP)
+	mgr.server = &http.Server{Handler: mux}
+	tcp_servers.Store(mgr.componentID, mgr)
+	go func() {
+		if err := mgr.server.Serve(listener); err != nil && mgr.isRunning() {
+			slog.LogError("ws_server", "Serve Error: %v", err)
+		}
+	}()
+	return true
+}
+
+func (mgr *WsServerMgr) Close() {
+	if atomic.CompareAndSwapInt32(&mgr.closeFlag, 0, 1) {
+		tcp_servers.Delete(mgr.componentID)
+		if mgr.server == nil {
+			return
+		}
+		_ = mgr.server.Close()
+	}
+}
+
+// Drain stops accepting and drains the accepted linkers, waiting at most
+// timeout.
+func (mgr *WsServerMgr) Drain(timeout int64) {
+	mgr.Close()
+	if !mgr.drainConns(mgr.module, mgr.componentID, timeout) {
+		slog.LogWarning("ws_server", "ws server [%v] drain timeout", mgr.addr)
+	}
+}
+
+func (mgr *WsServerMgr) isRunning() bool {
+	return atomic.LoadInt32(&mgr.closeFlag) == 0
+}
+
+func (mgr *WsServerMgr) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rawConn, err := mgr.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.LogWarning("ws_server", "upgrade %v error: %v", r.RemoteAddr, err)
+		return
+	}
+
+	m := mgr.module
+	wsAgent := newWsConn(rawConn, mgr.agentHandler, Linker_TCP_InComming, &mgr.option)
+	mgr.addConn(wsAgent)
+	m.PostEvent(event.EVENT_TCP_ACCEPTED, wsAgent, mgr.componentID)
+
+	pingMgr.AddPing(wsAgent)
+	err = wsAgent.Run()
+	pingMgr.RemovePing(wsAgent)
+	mgr.removeConn(wsAgent)
+	m.PostEvent(event.EVENT_TCP_CLOSED, wsAgent, mgr.componentID, err)
+}
+
+func (mgr *WsServerMgr) GetOption() *TransportOption {
+	return &mgr.option
+}
@@ -0,0 +1,63 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/jslyzt/einx/event"
+)
+
+type nopReceiver struct{}
+
+func (nopReceiver) PostEvent(event.EventType, Agent, ComponentID, ...interface{}) {}
+func (nopReceiver) PostData(event.EventType, ProtoTypeID, Agent, interface{})     {}
+func (nopReceiver) PushEventMsg(event.EventMsg)                                   {}
+
+// dialOrigin upgrades a request with the origin header through the upgrader
+// of a server built with opts.
+func dialOrigin(t *testing.T, origin string, opts ...Option) int {
+	opts = append(opts, Module(nopReceiver{}), ServeHandler(&keepHandler{}))
+	mgr := NewWsServerMgr(opts...).(*WsServerMgr)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := mgr.upgrader.Upgrade(w, r, nil); err == nil {
+			c.Close()
+		}
+	}))
+	defer s.Close()
+
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", strings.Replace(origin, "SELF", s.URL, 1))
+	}
+	c, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), header)
+	if err == nil {
+		c.Close()
+	}
+	if resp == nil {
+		t.Fatalf("dial %q: %v", origin, err)
+	}
+	return resp.StatusCode
+}
+
+func TestWsCheckOrigin(t *testing.T) {
+	for _, d := range []struct {
+		origin string
+		opts   []Option
+		want   int
+	}{
+		{"", nil, http.StatusSwitchingProtocols},
+		{"SELF", nil, http.StatusSwitchingProtocols},
+		{"http://evil.example", nil, http.StatusForbidden},
+		{"http://evil.example", []Option{WsCheckOrigin(func(*http.Request) bool { return true })}, http.StatusSwitchingProtocols},
+		{"SELF", []Option{WsCheckOrigin(func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "http://game.example"
+		})}, http.StatusForbidden},
+	} {
+		if got := dialOrigin(t, d.origin, d.opts...); got != d.want {
+			t.Errorf("origin %q with %d options: status %d, want %d", d.origin, len(d.opts), got, d.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package einx
 
 import (
+	"crypto/tls"
+	"net/http"
+
 	"github.com/jslyzt/einx/event"
 	"github.com/jslyzt/einx/module"
 	"github.com/jslyzt/einx/network"
@@ -27,14 +30,36 @@ func OnClosing(f func()) Option {
 	}
 }
 
+// DrainTimeout makes Close drain every tcp server for at most timeout milliseconds before the modules close.
+func DrainTimeout(timeout int64) Option {
+	return func(args ...interface{}) {
+		_einxDefault.drainTimeout = timeout
+	}
+}
+
 type networkOpt struct {
-	Name               func(string) Option
-	Module             func(string) Option
-	ListenAddr         func(string) Option
-	ServeHandler       func(SessionHandler) Option
-	TransportMaxCount  func(int) Option
-	TransportMaxLength func(int) Option
-	TransportKeepAlive func(bool, int64) Option
+	Name                 func(string) Option
+	Module               func(string) Option
+	ListenAddr           func(string) Option
+	ServeHandler         func(SessionHandler) Option
+	TransportMaxCount    func(int) Option
+	TransportMaxLength   func(int) Option
+	TransportLimitAction func(int) Option
+	TransportWriteLimit  func(int, int, int) Option
+	TransportWriteBatch  func(int, int, int64) Option
+	TransportKeepAlive   func(bool, int64) Option
+	TransportCompress    func(uint8, int) Option
+	TransportEncrypt     func(bool) Option
+	Reconnect            func(int64, int64, float64, int) Option
+	DialTimeout          func(int64) Option
+	TLSConfig            func(*tls.Config) Option
+	TLSCertFile          func(string, string) Option
+	TLSCAFile            func(string) Option
+	WsPath               func(string) Option
+	WsCheckOrigin        func(func(*http.Request) bool) Option
+	KcpNoDelay           func(bool, int, int, bool) Option
+	KcpWindow            func(int, int) Option
+	KcpMtu               func(int) Option
 }
 
 var NetworkOption networkOpt = networkOpt{
@@ -43,9 +68,24 @@ var NetworkOption networkOpt = networkOpt{
 		m := GetModule(s)
 		return network.Module(m.(event.EventReceiver))
 	},
-	ListenAddr:         network.ListenAddr,
-	ServeHandler:       network.ServeHandler,
-	TransportMaxCount:  network.TransportMaxCount,
-	TransportMaxLength: network.TransportMaxLength,
-	TransportKeepAlive: network.TransportKeepAlive,
+	ListenAddr:           network.ListenAddr,
+	ServeHandler:         network.ServeHandler,
+	TransportMaxCount:    network.TransportMaxCount,
+	TransportMaxLength:   network.TransportMaxLength,
+	TransportLimitAction: network.TransportLimitAction,
+	TransportWriteLimit:  network.TransportWriteLimit,
+	TransportWriteBatch:  network.TransportWriteBatch,
+	TransportKeepAlive:   network.TransportKeepAlive,
+	TransportCompress:    network.TransportCompress,
+	TransportEncrypt:     network.TransportEncrypt,
+	Reconnect:            network.Reconnect,
+	DialTimeout:          network.DialTimeout,
+	TLSConfig:            network.TLSConfig,
+	TLSCertFile:          network.TLSCertFile,
+	TLSCAFile:            network.TLSCAFile,
+	WsPath:               network.WsPath,
+	WsCheckOrigin:        network.WsCheckOrigin,
+	KcpNoDelay:           network.KcpNoDelay,
+	KcpWindow:            network.KcpWindow,
+	KcpMtu:               network.KcpMtu,
 }
@@ -63,3 +63,22 @@ func (c *CondQueue) Get(list []interface{}, count uint32) uint32 {
 	atomic.AddInt32(&c.count, 0-int32(readCount))
 	return readCount
 }
+
+// TryGet is Get without waiting, it returns 0 when the queue is empty.
+func (c *CondQueue) TryGet(list []interface{}, count uint32) uint32 {
+	readCount, _ := c.rwQueue.Get(list, count)
+	atomic.AddInt32(&c.count, 0-int32(readCount))
+	return readCount
+}
+
+func (c *CondQueue) Pop() (interface{}, bool) {
+	msg, ok := c.rwQueue.Pop()
+	if ok {
+		atomic.AddInt32(&c.count, -1)
+	}
+	return msg, ok
+}
+
+func (c *CondQueue) Count() int {
+	return int(atomic.LoadInt32(&c.count))
+}
@@ -98,6 +98,22 @@ func (q *RWQueue) GetOne() interface{} {
 	return val
 }
 
+// Pop removes the oldest element, it may be called concurrently with Get.
+func (q *RWQueue) Pop() (interface{}, bool) {
+	q.readLock.Lock()
+	defer q.readLock.Unlock()
+
+	if q.readQueue.empty() {
+		q.writeLock.Lock()
+		if !q.exchange() {
+			q.writeLock.Unlock()
+			return nil, false
+		}
+		q.writeLock.Unlock()
+	}
+	return q.readQueue.pop()
+}
+
 func (q *RWQueue) Empty() bool {
 	q.readLock.Lock()
 	defer q.readLock.Unlock()